@@ -6,12 +6,15 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -19,10 +22,30 @@ import (
 	"github.com/itchyny/gojq"
 	"github.com/rs/cors"
 
+	"github.com/delta10/filter-proxy/internal/audit"
 	"github.com/delta10/filter-proxy/internal/config"
+	"github.com/delta10/filter-proxy/internal/feature"
+	"github.com/delta10/filter-proxy/internal/fields"
+	"github.com/delta10/filter-proxy/internal/geometry"
+	"github.com/delta10/filter-proxy/internal/jq"
+	"github.com/delta10/filter-proxy/internal/jsonschema"
+	"github.com/delta10/filter-proxy/internal/jwks"
+	"github.com/delta10/filter-proxy/internal/mvt"
+	"github.com/delta10/filter-proxy/internal/ogcapi"
+	"github.com/delta10/filter-proxy/internal/ows"
 	"github.com/delta10/filter-proxy/internal/route"
 	"github.com/delta10/filter-proxy/internal/utils"
+	"github.com/delta10/filter-proxy/internal/wcs"
 	"github.com/delta10/filter-proxy/internal/wfs"
+	"github.com/delta10/filter-proxy/internal/wms"
+	"github.com/delta10/filter-proxy/internal/wps"
+)
+
+// Counters of the requests and responses that do not match the schemas of
+// their path, by path.
+var (
+	invalidRequests  = expvar.NewMap("invalidRequests")
+	invalidResponses = expvar.NewMap("invalidResponses")
 )
 
 type ClaimsWithGroups struct {
@@ -31,9 +54,30 @@ type ClaimsWithGroups struct {
 }
 
 type AuthorizationResponse struct {
-	Result         bool   `json:"result"`
-	ResponseFilter string `json:"response_filter"`
-	Username       string `json:"username"`
+	Result             bool                `json:"result"`
+	ResponseFilter     string              `json:"response_filter"`
+	Username           string              `json:"username"`
+	Resources          map[string]bool     `json:"resources"`
+	Attributes         map[string][]string `json:"attributes"`
+	WritableAttributes map[string][]string `json:"writable_attributes"`
+	AllowedArea        *AllowedArea        `json:"allowed_area"`
+
+	// allowedAreas and writableAttributes hold the allowed area and writable
+	// attributes of every combination of layer and operation of a wfs
+	// transaction, which are each authorized separately.
+	allowedAreas       map[utils.TransactionMetadata]*AllowedArea
+	writableAttributes map[utils.TransactionMetadata]feature.AttributePolicy
+}
+
+// AllowedArea is the area to which the edits of a layer are restricted, given
+// as a WKT or GeoJSON (multi)polygon. CRS is required, unless the WKT has an
+// EWKT SRID prefix. Property is the geometry property of the layer, which
+// overrides the geometryProperties of the path.
+type AllowedArea struct {
+	WKT      string          `json:"wkt"`
+	GeoJSON  json.RawMessage `json:"geojson"`
+	CRS      string          `json:"crs"`
+	Property string          `json:"property"`
 }
 
 func main() {
@@ -42,6 +86,18 @@ func main() {
 		log.Fatalln(err)
 	}
 
+	responseFilters := jq.NewCache(config.JqCacheSize, []byte(config.JqHashKey))
+
+	var keySet *jwks.KeySet
+	if config.JwksURL != "" {
+		keySet = jwks.New(config.JwksURL, config.JwksIssuer, config.JwksAudience)
+	}
+
+	auditSink, err := audit.NewSink(config.Audit)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	router := mux.NewRouter()
 	for _, configuredPath := range config.Paths {
 		path := configuredPath
@@ -94,6 +150,11 @@ func main() {
 				w.WriteHeader(resp.StatusCode)
 				io.Copy(w, resp.Body)
 			})
+		} else if path.Spec != nil {
+			router.HandleFunc(path.Path, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/vnd.oai.openapi+json")
+				w.Write(path.Spec)
+			}).Methods(http.MethodGet, http.MethodHead)
 		} else {
 			router.HandleFunc(path.Path, func(w http.ResponseWriter, r *http.Request) {
 				body, _ := io.ReadAll(r.Body)
@@ -104,52 +165,139 @@ func main() {
 					return
 				}
 
+				var exceptions *ows.Exceptions
+				if backend.Type == "OWS" || backend.Type == "WMTS" {
+					requestExceptions := ows.RequestExceptions(backend.Type, r.URL.Query(), body)
+					exceptions = &requestExceptions
+				}
+
 				utils.DelHopHeaders(r.Header)
 
-				var bodyFilterParams map[string]interface{}
-				if path.RequestRewrite != "" {
-					var result map[string]interface{}
-					json.Unmarshal(body, &result)
+				if path.RequestSchemaValidator != nil && (len(body) > 0 || r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch) {
+					if violations := validateRequestBody(path.RequestSchemaValidator, body); len(violations) > 0 {
+						invalidRequests.Add(path.Path, 1)
+						writeViolations(w, violations)
+						return
+					}
+				}
 
-					query, err := gojq.Parse(path.RequestRewrite)
-					if err != nil {
-						writeError(w, http.StatusInternalServerError, "could not parse filter")
+				if err := path.CheckQuery(r.URL.Query()); err != nil {
+					writeServiceError(w, exceptions, http.StatusBadRequest, err.Error())
+					return
+				}
+
+				if operation := path.Operations[r.Method]; operation != nil {
+					if violations := operation.Validate(mux.Vars(r), r.URL.Query(), r.Header, body); len(violations) > 0 {
+						invalidRequests.Add(path.Path, 1)
+						writeViolations(w, violations)
 						return
 					}
+				}
 
-					iter := query.Run(result)
-					for {
-						v, ok := iter.Next()
-						if !ok {
-							break
+				var bodyFilterParams map[string]interface{}
+				if path.RequestRewrite != "" {
+					var result interface{}
+					if len(bytes.TrimSpace(body)) > 0 {
+						if err := json.Unmarshal(body, &result); err != nil {
+							writeServiceError(w, exceptions, http.StatusBadRequest, "could not parse request body as json")
+							return
 						}
+					}
 
-						if _, ok := v.(error); ok {
-							continue
-						}
+					output, err := jq.Run(r.Context(), path.RequestRewriteCode, result, rewriteContext(config, keySet, r, ""), jq.OutputFirst)
+					if err != nil {
+						log.Printf("could not run requestRewrite for path %s: %s", path.Path, err)
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not rewrite request")
+						return
+					}
 
-						bodyFilterParams = v.(map[string]interface{})
+					switch params := output.(type) {
+					case nil:
+					case map[string]interface{}:
+						bodyFilterParams = params
+					default:
+						log.Printf("requestRewrite for path %s returned %T instead of an object", path.Path, output)
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not rewrite request")
+						return
 					}
 				}
 
-				authorizationStatusCode, authorizationResponse, isTransaction := authorizeRequestWithService(config, backend, path, r, bodyFilterParams, body)
+				// The authorization service is given the query that is sent to
+				// the backend, in which the username is not replaced yet.
+				queryReplacements := map[string]string{}
+				for name, value := range mux.Vars(r) {
+					queryReplacements[name] = value
+				}
+				backendQuery := path.BackendQuery(r.URL.Query(), queryReplacements)
+
+				authorizationStatusCode, authorizationResponse, isTransaction := authorizeRequestWithService(config, backend, path, r, backendQuery, bodyFilterParams, body)
 				if authorizationStatusCode != http.StatusOK {
-					writeError(w, authorizationStatusCode, "unauthorized request")
+					writeServiceError(w, exceptions, authorizationStatusCode, "unauthorized request")
 					return
 				}
 
 				if !authorizationResponse.Result {
-					writeError(w, http.StatusUnauthorized, "result field is not true")
+					writeServiceError(w, exceptions, http.StatusUnauthorized, "result field is not true")
 					return
 				}
 
+				if backend.Type == "OWS" && utils.QueryParamsToLower(r.URL.Query()).Get("service") == "WMS" {
+					if statusCode, message := authorizeLayers(path, r, authorizationResponse); statusCode != http.StatusOK {
+						writeServiceError(w, exceptions, statusCode, message)
+						return
+					}
+				}
+
+				featurePolicy, featureLayer := featureInfoPolicy(backend, path, r, authorizationResponse)
+				if featurePolicy == nil {
+					var statusCode int
+					var message string
+					statusCode, message, featurePolicy, featureLayer, body = getFeaturePolicy(backend, path, r, body, authorizationResponse)
+					if statusCode != http.StatusOK {
+						writeServiceError(w, exceptions, statusCode, message)
+						return
+					}
+				}
+
+				var ogcRequest ogcapi.Request
+				var ogcPolicy feature.AttributePolicy
+				if backend.Type == "OGCAPI" {
+					ogcRequest = ogcapi.ParsePath(r.URL.Path)
+
+					policy := feature.MergePolicies(path.AllowedAttributes, authorizationResponse.Attributes)
+					if _, restricted := policy.Restricted(ogcRequest.Collection); restricted && ogcRequest.HasFeatures() {
+						if format := utils.QueryParamsToLower(r.URL.Query()).Get("f"); format != "" && !strings.Contains(strings.ToLower(format), "json") {
+							writeServiceError(w, exceptions, http.StatusBadRequest, "format can not be used for restricted collections")
+							return
+						}
+
+						ogcPolicy = policy
+					}
+
+					// The collections in a /collections response are filtered by
+					// the collections the authorization service allows, which it
+					// therefore has to return.
+					if ogcRequest.Kind == "collections" {
+						if authorizationResponse.Resources == nil {
+							log.Printf("authorization service returned no resources for %s", r.URL.Path)
+							writeServiceError(w, exceptions, http.StatusUnauthorized, "unauthorized request")
+							return
+						}
+
+						if format := utils.QueryParamsToLower(r.URL.Query()).Get("f"); format != "" && !strings.Contains(strings.ToLower(format), "json") {
+							writeServiceError(w, exceptions, http.StatusBadRequest, "format can not be used for collections")
+							return
+						}
+					}
+				}
+
 				allowedMethods := path.AllowedMethods
 				if len(allowedMethods) == 0 {
 					allowedMethods = []string{"GET"}
 				}
 
 				if !utils.StringInSlice(r.Method, allowedMethods) {
-					writeError(w, http.StatusBadRequest, "request method is not allowed")
+					writeServiceError(w, exceptions, http.StatusBadRequest, "request method is not allowed")
 					return
 				}
 
@@ -157,32 +305,34 @@ func main() {
 
 				parsedRequestPath, err := routeRegexp.URL(mux.Vars(r))
 				if err != nil {
-					writeError(w, http.StatusBadRequest, "could not parse request URL")
+					writeServiceError(w, exceptions, http.StatusBadRequest, "could not parse request URL")
 					return
 				}
 
 				backendBaseUrl, err := url.Parse(backend.BaseURL)
 				if err != nil {
-					writeError(w, http.StatusInternalServerError, "could not parse backend URL")
+					writeServiceError(w, exceptions, http.StatusInternalServerError, "could not parse backend URL")
 					return
 				}
 
 				fullBackendURL := backendBaseUrl.JoinPath(parsedRequestPath)
 
 				// Copy query parameters to backend
-				fullBackendURL.RawQuery = r.URL.Query().Encode()
+				queryReplacements["REQUEST_USERNAME"] = authorizationResponse.Username
+				fullBackendURL.RawQuery = path.BackendQuery(r.URL.Query(), queryReplacements).Encode()
 
 				var backendRequest *http.Request
+				var auditedTransaction *wfs.Transaction
 				if len(bodyFilterParams) > 0 {
 					backendRequestBody, err := json.MarshalIndent(bodyFilterParams, "", "    ")
 					if err != nil {
-						writeError(w, http.StatusInternalServerError, "could not marshal json")
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not marshal json")
 						return
 					}
 
 					backendRequest, err = http.NewRequest(r.Method, fullBackendURL.String(), bytes.NewReader(backendRequestBody))
 					if err != nil {
-						writeError(w, http.StatusInternalServerError, "could not construct backend request")
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not construct backend request")
 						return
 					}
 
@@ -195,39 +345,76 @@ func main() {
 
 						err := xml.Unmarshal(body, &transactionBody)
 						if len(body) > 0 && err != nil {
-							writeError(w, http.StatusBadRequest, "Error validating transaction body while constructing backend request")
+							writeServiceError(w, exceptions, http.StatusBadRequest, "Error validating transaction body while constructing backend request")
+							return
+						}
+
+						if err := transactionBody.CheckWritableProperties(writePolicies(path, authorizationResponse)); err != nil {
+							log.Printf("rejected wfs transaction: %s", err)
+							writeServiceError(w, exceptions, http.StatusUnauthorized, "transaction modifies read-only properties")
+							return
+						}
+
+						restrictions, err := areaRestrictions(path, authorizationResponse)
+						if err != nil {
+							log.Printf("could not parse allowed area: %s", err)
+							writeServiceError(w, exceptions, http.StatusInternalServerError, "could not parse allowed area")
 							return
 						}
 
+						if err := transactionBody.RestrictToAreas(restrictions); err != nil {
+							log.Printf("rejected wfs transaction: %s", err)
+							writeServiceError(w, exceptions, http.StatusUnauthorized, "transaction edits features outside of the allowed area")
+							return
+						}
+
+						injectedValues := map[string]map[string]string{}
+						for layer, values := range path.InjectAttributes {
+							injectedValues[layer] = map[string]string{}
+							for property, value := range values {
+								injectedValues[layer][property] = utils.EnvSubst(value, map[string]string{
+									"REQUEST_USERNAME": authorizationResponse.Username,
+								})
+							}
+						}
+						transactionBody.InjectProperties(injectedValues)
+
 						marshaledBody, err := xml.Marshal(transactionBody)
 						if err != nil {
-							writeError(w, http.StatusInternalServerError, "Error processing transaction body")
+							writeServiceError(w, exceptions, http.StatusInternalServerError, "Error processing transaction body")
 							return
 						}
 
 						requestBody = bytes.NewReader(marshaledBody)
+						auditedTransaction = &transactionBody
+					} else if backend.Type == "OWS" && len(body) > 0 {
+						requestBody = bytes.NewReader(body)
 					}
 
 					backendRequest, err = http.NewRequest(r.Method, fullBackendURL.String(), requestBody)
 
 					if err != nil {
-						writeError(w, http.StatusInternalServerError, "could not construct backend request")
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not construct backend request")
 						return
 					}
+
+					if requestBody != nil {
+						backendRequest.Header.Set("Content-Type", "text/xml")
+					}
 				}
 
 				tlsConfig := &tls.Config{}
 				if backend.Auth.TLS.RootCertificates != "" {
 					rootCertificates, err := os.ReadFile(backend.Auth.TLS.RootCertificates)
 					if err != nil {
-						writeError(w, http.StatusInternalServerError, "could not retrieve root certs for backend")
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not retrieve root certs for backend")
 						return
 					}
 
 					roots := x509.NewCertPool()
 					ok := roots.AppendCertsFromPEM(rootCertificates)
 					if !ok {
-						writeError(w, http.StatusInternalServerError, "could not load root certs for backend")
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not load root certs for backend")
 						return
 					}
 
@@ -237,7 +424,7 @@ func main() {
 				if backend.Auth.TLS.Certificate != "" && backend.Auth.TLS.Key != "" {
 					cert, err := tls.LoadX509KeyPair(backend.Auth.TLS.Certificate, backend.Auth.TLS.Key)
 					if err != nil {
-						writeError(w, http.StatusInternalServerError, "could not load TLS keypair for backend")
+						writeServiceError(w, exceptions, http.StatusInternalServerError, "could not load TLS keypair for backend")
 						return
 					}
 
@@ -260,6 +447,16 @@ func main() {
 
 				addForwardedForHeaders(backendRequest, r)
 
+				if backend.Type == "OGCAPI" {
+					if ogcPolicy != nil {
+						backendRequest.Header.Set("Accept", "application/geo+json")
+					} else if ogcRequest.Kind == "collections" {
+						backendRequest.Header.Set("Accept", "application/json")
+					} else if r.Header.Get("Accept") != "" {
+						backendRequest.Header.Set("Accept", r.Header.Get("Accept"))
+					}
+				}
+
 				client := &http.Client{
 					Timeout:   25 * time.Second,
 					Transport: transport,
@@ -267,50 +464,51 @@ func main() {
 
 				proxyResp, err := client.Do(backendRequest)
 				if err != nil {
-					writeError(w, http.StatusBadGateway, fmt.Sprintf("could not fetch backend response: %s", err))
+					writeServiceError(w, exceptions, http.StatusBadGateway, fmt.Sprintf("could not fetch backend response: %s", err))
 					return
 				}
 
 				defer proxyResp.Body.Close()
 
-				if proxyResp.StatusCode == http.StatusOK && (path.ResponseRewrite != "" || authorizationResponse.ResponseFilter != "") {
-					body, _ := io.ReadAll(proxyResp.Body)
-					var result map[string]interface{}
-					json.Unmarshal(body, &result)
-
-					var responseRewrite = ""
-					if authorizationResponse.ResponseFilter != "" {
-						responseRewrite = authorizationResponse.ResponseFilter
-					} else {
-						responseRewrite = path.ResponseRewrite
+				tilePolicy := feature.MergePolicies(path.AllowedAttributes, authorizationResponse.Attributes)
+				rewriteResponse := path.RewritesResponse(proxyResp.StatusCode) &&
+					(path.ResponseRewrite != "" || path.ResponseFields != nil || path.ResponseSchema != "" || authorizationResponse.ResponseFilter != "")
+				isVectorTile := mvt.IsVectorTileRequest(r.URL.Path, utils.QueryParamsToLower(r.URL.Query()), r.Header.Get("Accept")) ||
+					mvt.IsVectorTile(proxyResp.Header.Get("Content-Type"))
+				filterTile := proxyResp.StatusCode == http.StatusOK && isVectorTile &&
+					(authorizationResponse.Resources != nil || len(tilePolicy) > 0)
+
+				if featurePolicy != nil && proxyResp.StatusCode == http.StatusOK {
+					writeFilteredFeatures(w, exceptions, proxyResp, featurePolicy, featureLayer, config.MaxResponseBodySize)
+				} else if filterTile {
+					writeVectorTile(w, exceptions, proxyResp, authorizationResponse.Resources, tilePolicy, config.MaxResponseBodySize)
+				} else if backend.Type == "OGCAPI" && proxyResp.StatusCode == http.StatusOK {
+					writeOGCAPIResponse(w, r, exceptions, proxyResp, fullBackendURL, publicBaseURL(config, r), ogcRequest, ogcPolicy, authorizationResponse.Resources, config.MaxResponseBodySize)
+				} else if auditedTransaction != nil {
+					writeTransactionResponse(w, r, proxyResp, auditSink, *auditedTransaction, authorizationResponse.Username, config.MaxResponseBodySize)
+				} else if rewriteResponse || path.RewritesError(proxyResp.StatusCode) {
+					rewrite := responseRewrite{path: path.Path, query: path.ErrorRewriteCode, mode: path.ResponseRewriteOutput}
+					if rewriteResponse {
+						rewrite.query = path.ResponseRewriteCode
+						rewrite.selection = path.ResponseFieldsSelection
+						rewrite.schema = path.ResponseSchemaValidator
+						rewrite.blockInvalid = path.BlockInvalidResponses
 					}
 
-					query, err := gojq.Parse(responseRewrite)
-					if err != nil {
-						writeError(w, http.StatusInternalServerError, "could not parse filter")
-						return
-					}
-
-					iter := query.Run(result)
-					for {
-						v, ok := iter.Next()
-						if !ok {
-							break
-						}
-
-						if _, ok := v.(error); ok {
-							continue
-						}
-
-						response, err := json.MarshalIndent(v, "", "    ")
+					if rewriteResponse && authorizationResponse.ResponseFilter != "" {
+						rewrite.query, err = responseFilters.Get(authorizationResponse.ResponseFilter)
 						if err != nil {
-							writeError(w, http.StatusInternalServerError, "could not marshal json")
+							log.Printf("could not compile response_filter of the authorization service: %s", err)
+							writeServiceError(w, exceptions, http.StatusInternalServerError, "could not parse filter")
 							return
 						}
+					}
 
-						w.Header().Set("Content-Type", "application/json")
-						w.Header().Set("Cache-Control", "private")
-						w.Write(response)
+					context := rewriteContext(config, keySet, r, authorizationResponse.Username)
+					if rewriteResponse && path.ResponseStream != "" && authorizationResponse.ResponseFilter == "" {
+						writeStreamedResponse(w, r, exceptions, proxyResp, rewrite.query, path, context, config.MaxResponseBodySize)
+					} else {
+						writeRewrittenResponse(w, r, exceptions, proxyResp, rewrite, context, config.MaxResponseBodySize)
 					}
 				} else {
 					utils.DelHopHeaders(proxyResp.Header)
@@ -323,6 +521,22 @@ func main() {
 		}
 	}
 
+	if config.ExpvarListenAddress != "" {
+		// The counters are served on a listener of their own, so that they are
+		// not reachable through the proxy without authorization.
+		expvarServer := &http.Server{
+			Addr:         config.ExpvarListenAddress,
+			Handler:      expvar.Handler(),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			log.Printf("publishing counters on %v", config.ExpvarListenAddress)
+			log.Fatal(expvarServer.ListenAndServe())
+		}()
+	}
+
 	// By default allow only https://filter-proxy.local
 	corsOptions := cors.Options{
 		AllowedOrigins: []string{
@@ -372,7 +586,7 @@ func main() {
 	}
 }
 
-func authorizeRequestWithService(config *config.Config, backend config.Backend, path config.Path, r *http.Request, filterParams map[string]interface{}, body []byte) (int, *AuthorizationResponse, bool) {
+func authorizeRequestWithService(config *config.Config, backend config.Backend, path config.Path, r *http.Request, backendQuery url.Values, filterParams map[string]interface{}, body []byte) (int, *AuthorizationResponse, bool) {
 	if config.AuthorizationServiceURL == "" {
 		log.Print("returned unauthenticated as there is no authorization service URL configured")
 		return http.StatusInternalServerError, nil, false
@@ -390,6 +604,7 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 	}
 
 	isTransactionSet := false
+	var transactionActions []utils.TransactionMetadata
 
 	if backend.Type == "OWS" {
 		queryParams := utils.QueryParamsToLower(r.URL.Query())
@@ -403,7 +618,28 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 			return http.StatusBadRequest, nil, false
 		}
 
-		err := xml.Unmarshal(body, &transaction)
+		var getFeature wfs.GetFeature
+		var describeFeatureType wfs.DescribeFeatureType
+		var coverageRequest wcs.Request
+		var processRequest wps.Request
+		var err error
+		switch rootName, _ := wfs.RootElement(body); rootName.Local {
+		case "GetFeature", "GetPropertyValue":
+			err = xml.Unmarshal(body, &getFeature)
+			serviceParam, requestParam = "WFS", rootName.Local
+		case "DescribeFeatureType":
+			err = xml.Unmarshal(body, &describeFeatureType)
+			serviceParam, requestParam = "WFS", rootName.Local
+		case "GetCoverage", "DescribeCoverage":
+			err = xml.Unmarshal(body, &coverageRequest)
+			serviceParam, requestParam = "WCS", rootName.Local
+		case "Execute", "DescribeProcess":
+			processRequest, err = wps.ParseRequest(body)
+			serviceParam, requestParam = "WPS", rootName.Local
+		default:
+			err = xml.Unmarshal(body, &transaction)
+		}
+
 		transactionSet := transaction.XMLName.Local != ""
 		isTransactionSet = transactionSet
 
@@ -412,6 +648,20 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 			return http.StatusBadRequest, nil, false
 		}
 
+		if transactionSet {
+			if err := transaction.Validate(); err != nil {
+				log.Printf("Invalid transaction in request body: %v", err)
+				return http.StatusBadRequest, nil, false
+			}
+
+			// The content of native actions can not be inspected, so they are
+			// only forwarded when the path explicitly allows them.
+			if len(transaction.Natives) > 0 && !path.AllowNativeActions {
+				log.Printf("rejected wfs transaction with native actions")
+				return http.StatusBadRequest, nil, false
+			}
+		}
+
 		if transactionSet {
 			authorizationBody["service"] = "WFS"
 		} else {
@@ -421,7 +671,9 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 		authorizationBody["request"] = requestParam
 
 		if authorizationBody["service"] == "WMS" {
-			authorizationBody["resource"] = queryParams.Get("layers") + queryParams.Get("layer")
+			layers := wms.RequestedLayers(queryParams)
+			authorizationBody["resource"] = strings.Join(layers, ",")
+			authorizationBody["resources"] = layers
 			authorizationBody["params"] = map[string]interface{}{
 				"service":    serviceParam,
 				"request":    requestParam,
@@ -429,23 +681,99 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 			}
 		} else if authorizationBody["service"] == "WFS" {
 			if transactionSet {
-				layerName, transactionCount := utils.GetTransactionMetadata(transaction)
+				transactionActions = utils.GetTransactionMetadata(transaction)
 
-				if transactionCount > 1 {
-					log.Printf("we only allow one wfs transaction at a time")
+				if len(transactionActions) == 0 {
+					log.Printf("rejected wfs transaction without actions")
 					return http.StatusBadRequest, nil, false
 				}
 
-				authorizationBody["resource"] = layerName
 				authorizationBody["request"] = "Transaction"
+			} else if getFeature.XMLName.Local != "" {
+				// Stored queries do not name the feature types they query, so
+				// they can not be authorized.
+				if len(getFeature.StoredQueries) > 0 || len(getFeature.TypeNames()) == 0 {
+					log.Printf("rejected wfs %s without type names", requestParam)
+					return http.StatusBadRequest, nil, false
+				}
+
+				authorizationBody["resource"] = strings.Join(getFeature.TypeNames(), ",")
+				authorizationBody["params"] = map[string]interface{}{
+					"service":        serviceParam,
+					"request":        requestParam,
+					"version":        getFeature.Version,
+					"filters":        getFeature.Filters(),
+					"valuereference": getFeature.ValueReference,
+				}
+			} else if describeFeatureType.XMLName.Local != "" {
+				authorizationBody["resource"] = strings.Join(describeFeatureType.TypeNames, ",")
+				authorizationBody["params"] = map[string]interface{}{
+					"service": serviceParam,
+					"request": requestParam,
+					"version": describeFeatureType.Version,
+				}
 			} else {
-				authorizationBody["resource"] = queryParams.Get("typename") + queryParams.Get("typenames")
+				// Requests by feature identifier or stored query do not name
+				// the feature types they query, so they can not be authorized.
+				typeNames := wfs.QueryTypeNames(queryParams)
+				if (strings.EqualFold(requestParam, "GetFeature") || strings.EqualFold(requestParam, "GetPropertyValue")) &&
+					(len(typeNames) == 0 || queryParams.Get("storedquery_id") != "") {
+					log.Printf("rejected wfs %s without type names", requestParam)
+					return http.StatusBadRequest, nil, false
+				}
+
+				authorizationBody["resource"] = strings.Join(typeNames, ",")
 				authorizationBody["params"] = map[string]interface{}{
 					"service":    serviceParam,
 					"request":    requestParam,
 					"cql_filter": queryParams.Get("cql_filter"),
 				}
 			}
+		} else if authorizationBody["service"] == "WCS" {
+			coverages := wcs.RequestedCoverages(queryParams)
+			version := queryParams.Get("version")
+			if coverageRequest.XMLName.Local != "" {
+				coverages, version = coverageRequest.Coverages(), coverageRequest.Version
+			}
+
+			authorizationBody["resource"] = strings.Join(coverages, ",")
+			authorizationBody["resources"] = coverages
+			authorizationBody["params"] = map[string]interface{}{
+				"service": serviceParam,
+				"request": requestParam,
+				"version": version,
+			}
+		} else if authorizationBody["service"] == "WPS" {
+			if processRequest.XMLName.Local == "" {
+				processRequest, err = wps.ParseQuery(queryParams)
+				if err != nil {
+					log.Printf("rejected wps request: %s", err)
+					return http.StatusBadRequest, nil, false
+				}
+			}
+
+			// The backend fetches the references itself, which must therefore
+			// not point anywhere else than at a known backend.
+			for _, reference := range processRequest.References {
+				if !referenceAllowed(config, path, reference) {
+					log.Printf("rejected wps request with reference %s", reference)
+					return http.StatusBadRequest, nil, false
+				}
+			}
+
+			// The layers that referenced requests read are authorized as
+			// resources of the request, besides the processes.
+			resources := append(append([]string{}, processRequest.Identifiers...), processRequest.Layers...)
+			authorizationBody["resource"] = strings.Join(resources, ",")
+			authorizationBody["resources"] = resources
+			authorizationBody["params"] = map[string]interface{}{
+				"service":    serviceParam,
+				"request":    requestParam,
+				"version":    processRequest.Version,
+				"processes":  processRequest.Identifiers,
+				"layers":     processRequest.Layers,
+				"references": processRequest.References,
+			}
 		} else {
 			log.Printf("unauthorized service type: %s", authorizationBody["service"])
 			return http.StatusUnauthorized, nil, false
@@ -459,12 +787,27 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 			"service": queryParams.Get("service"),
 			"request": queryParams.Get("request"),
 		}
+	} else if backend.Type == "OGCAPI" {
+		request := ogcapi.ParsePath(r.URL.Path)
+		authorizationBody["service"] = "OGCAPI"
+		authorizationBody["request"] = request.Kind
+		authorizationBody["resource"] = request.Collection
+
+		params := make(map[string]interface{})
+		for k, v := range backendQuery {
+			params[k] = v
+		}
+		if request.FeatureID != "" {
+			params["featureId"] = request.FeatureID
+		}
+
+		authorizationBody["params"] = params
 	} else if backend.Type == "REST" {
 		authorizationBody["resource"] = path.Backend.Path
 
 		params := make(map[string]interface{})
 
-		for k, v := range r.URL.Query() {
+		for k, v := range backendQuery {
 			params[k] = v
 		}
 
@@ -480,16 +823,207 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 		return http.StatusInternalServerError, nil, false
 	}
 
+	if len(transactionActions) > 0 {
+		statusCode, responseData := authorizeTransaction(config, r, authorizationBody, transactionActions)
+		return statusCode, responseData, isTransactionSet
+	}
+
+	statusCode, responseData := requestAuthorization(config, r, authorizationBody)
+
+	// Every coverage of a WCS request and every process and referenced layer
+	// of a WPS request has to be allowed when the authorization service
+	// decides per resource.
+	service := authorizationBody["service"]
+	if resources, ok := authorizationBody["resources"].([]string); ok && (service == "WCS" || service == "WPS") && statusCode == http.StatusOK && responseData.Resources != nil {
+		for _, resource := range resources {
+			if !responseData.Resources[resource] {
+				log.Printf("denied %s in %s request", resource, strings.ToLower(service.(string)))
+				return http.StatusUnauthorized, responseData, isTransactionSet
+			}
+		}
+	}
+
+	return statusCode, responseData, isTransactionSet
+}
+
+// referenceAllowed reports whether a reference in a WPS request points at the
+// base URL of a configured backend or at one of the allowedReferences of path.
+func referenceAllowed(config *config.Config, path config.Path, reference string) bool {
+	referenceURL, err := url.Parse(reference)
+	if err != nil {
+		return false
+	}
+
+	allowed := append([]string{}, path.AllowedReferences...)
+	for _, backend := range config.Backends {
+		allowed = append(allowed, backend.BaseURL)
+	}
+
+	for _, prefix := range allowed {
+		prefixURL, err := url.Parse(prefix)
+		if err != nil || prefixURL.Host == "" {
+			continue
+		}
+
+		prefixPath := strings.TrimSuffix(prefixURL.Path, "/")
+		if strings.EqualFold(referenceURL.Scheme, prefixURL.Scheme) && strings.EqualFold(referenceURL.Host, prefixURL.Host) &&
+			(referenceURL.Path == prefixPath || strings.HasPrefix(referenceURL.Path, prefixPath+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorizeTransaction authorizes every combination of layer and operation in
+// a WFS transaction separately. The transaction is only authorized when all of
+// them are, in which case the responses are combined into one that keeps the
+// allowed area and writable attributes of every combination.
+func authorizeTransaction(config *config.Config, r *http.Request, authorizationBody map[string]interface{}, actions []utils.TransactionMetadata) (int, *AuthorizationResponse) {
+	var combinedResponse *AuthorizationResponse
+	authorized := map[utils.TransactionMetadata]bool{}
+
+	for _, action := range actions {
+		if authorized[action] {
+			continue
+		}
+
+		actionBody := map[string]interface{}{}
+		for k, v := range authorizationBody {
+			actionBody[k] = v
+		}
+		actionBody["resource"] = action.Layer
+		actionBody["operation"] = action.Operation
+
+		statusCode, responseData := requestAuthorization(config, r, actionBody)
+		if statusCode != http.StatusOK || !responseData.Result {
+			log.Printf("denied %s on %s in wfs transaction", action.Operation, action.Layer)
+			return statusCode, responseData
+		}
+
+		area := responseData.AllowedArea
+		writableAttributes := responseData.WritableAttributes
+		if combinedResponse == nil {
+			combinedResponse = responseData
+			combinedResponse.writableAttributes = map[utils.TransactionMetadata]feature.AttributePolicy{}
+		} else {
+			combinedResponse.Attributes = feature.MergePolicies(combinedResponse.Attributes, responseData.Attributes)
+		}
+		combinedResponse.writableAttributes[action] = writableAttributes
+
+		if area != nil {
+			if combinedResponse.allowedAreas == nil {
+				combinedResponse.allowedAreas = map[utils.TransactionMetadata]*AllowedArea{}
+			}
+			combinedResponse.allowedAreas[action] = area
+		}
+
+		authorized[action] = true
+	}
+
+	return http.StatusOK, combinedResponse
+}
+
+// writePolicies returns the writable attributes of every combination of layer
+// and operation of a wfs transaction, where the decision of the authorization
+// service takes precedence over the writableAttributes of the path.
+func writePolicies(path config.Path, authorizationResponse *AuthorizationResponse) map[utils.TransactionMetadata]feature.AttributePolicy {
+	policies := map[utils.TransactionMetadata]feature.AttributePolicy{}
+	for action, writableAttributes := range authorizationResponse.writableAttributes {
+		policies[action] = feature.MergePolicies(path.WritableAttributes, writableAttributes)
+	}
+
+	return policies
+}
+
+// areaRestrictions parses the allowed areas of every combination of layer and
+// operation of a wfs transaction. The geometry property of a layer is taken
+// from the allowed area, or else from the geometryProperties of the path.
+func areaRestrictions(path config.Path, authorizationResponse *AuthorizationResponse) (map[utils.TransactionMetadata]wfs.AreaRestriction, error) {
+	restrictions := map[utils.TransactionMetadata]wfs.AreaRestriction{}
+
+	for action, area := range authorizationResponse.allowedAreas {
+		layer := action.Layer
+
+		var (
+			multiPolygon geometry.MultiPolygon
+			err          error
+		)
+		if len(area.GeoJSON) > 0 {
+			multiPolygon, err = geometry.ParseGeoJSON(area.GeoJSON)
+		} else {
+			multiPolygon, err = geometry.ParseWKT(area.WKT)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("allowed area of %s: %w", layer, err)
+		}
+
+		property := area.Property
+		if property == "" {
+			property = path.GeometryProperties[layer]
+		}
+		for name, geometryProperty := range path.GeometryProperties {
+			if property == "" && feature.LocalName(name) == feature.LocalName(layer) {
+				property = geometryProperty
+			}
+		}
+
+		crs := area.CRS
+		if crs == "" && len(area.GeoJSON) == 0 {
+			crs = geometry.WKTCRS(area.WKT)
+		}
+		if crs == "" {
+			return nil, fmt.Errorf("allowed area of %s has no crs", layer)
+		}
+
+		restrictions[action] = wfs.AreaRestriction{
+			Area:     multiPolygon,
+			CRS:      crs,
+			Property: property,
+		}
+	}
+
+	return restrictions, nil
+}
+
+// rewriteContext returns the request variables for jq programs. The claims of
+// the bearer token are only available when a jwksUrl is configured to verify
+// it with.
+func rewriteContext(config *config.Config, keySet *jwks.KeySet, r *http.Request, username string) jq.Context {
+	context := jq.Context{
+		User:    username,
+		Path:    mux.Vars(r),
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+		Env:     config.JqEnvironment,
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if keySet == nil || !ok {
+		return context
+	}
+
+	claims, err := keySet.Parse(token)
+	if err != nil {
+		log.Printf("could not verify bearer token: %s", err)
+		return context
+	}
+
+	context.Claims = claims
+	return context
+}
+
+func requestAuthorization(config *config.Config, r *http.Request, authorizationBody map[string]interface{}) (int, *AuthorizationResponse) {
 	marshalledAuthorizationBody, err := json.Marshal(authorizationBody)
 	if err != nil {
 		log.Print("could not marshall authorization body")
-		return http.StatusInternalServerError, nil, false
+		return http.StatusInternalServerError, nil
 	}
 
 	request, err := http.NewRequest("GET", config.AuthorizationServiceURL, bytes.NewReader(marshalledAuthorizationBody))
 	if err != nil {
 		log.Print("could not construct authorization request")
-		return http.StatusInternalServerError, nil, false
+		return http.StatusInternalServerError, nil
 	}
 
 	if r.Header.Get("Cookie") != "" {
@@ -509,7 +1043,7 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 	resp, err := client.Do(request)
 	if err != nil {
 		log.Printf("could not fetch authorization response: %s", err)
-		return http.StatusInternalServerError, nil, false
+		return http.StatusInternalServerError, nil
 	}
 
 	defer resp.Body.Close()
@@ -517,21 +1051,608 @@ func authorizeRequestWithService(config *config.Config, backend config.Backend,
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("could not read authorization response: %s", err)
-		return http.StatusInternalServerError, nil, false
+		return http.StatusInternalServerError, nil
 	}
 
 	responseData := AuthorizationResponse{}
 	err = json.Unmarshal(resBody, &responseData)
 	if err != nil {
 		log.Printf("could not unmarshal authorization response: %s", err)
-		return http.StatusInternalServerError, nil, false
+		return http.StatusInternalServerError, nil
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("received an authorization error: %v, %s", resp.StatusCode, resBody)
 	}
 
-	return resp.StatusCode, &responseData, isTransactionSet
+	return resp.StatusCode, &responseData
+}
+
+// authorizeLayers applies the per layer decisions of the authorization service
+// to a WMS request. Layers that are not explicitly allowed are either rejected
+// or, when the path is configured to do so, dropped from the request.
+func authorizeLayers(path config.Path, r *http.Request, authorizationResponse *AuthorizationResponse) (int, string) {
+	if authorizationResponse.Resources == nil {
+		return http.StatusOK, ""
+	}
+
+	denied := map[string]bool{}
+	for _, layer := range wms.RequestedLayers(utils.QueryParamsToLower(r.URL.Query())) {
+		if !authorizationResponse.Resources[layer] {
+			denied[layer] = true
+		}
+	}
+
+	if len(denied) == 0 {
+		return http.StatusOK, ""
+	}
+
+	if !path.DropUnauthorizedLayers {
+		return http.StatusUnauthorized, "unauthorized layer requested"
+	}
+
+	query := r.URL.Query()
+	if !wms.RemoveLayers(query, denied) {
+		return http.StatusUnauthorized, "none of the requested layers are authorized"
+	}
+
+	r.URL.RawQuery = query.Encode()
+
+	return http.StatusOK, ""
+}
+
+// featureInfoPolicy returns the attribute policy that applies to a WMS
+// GetFeatureInfo request, together with the queried layer if there is only
+// one. When the policy restricts any of the queried layers, INFO_FORMAT is
+// forced to a format that can be filtered.
+func featureInfoPolicy(backend config.Backend, path config.Path, r *http.Request, authorizationResponse *AuthorizationResponse) (feature.AttributePolicy, string) {
+	if backend.Type != "OWS" {
+		return nil, ""
+	}
+
+	queryParams := utils.QueryParamsToLower(r.URL.Query())
+	if queryParams.Get("service") != "WMS" || !strings.EqualFold(queryParams.Get("request"), "GetFeatureInfo") {
+		return nil, ""
+	}
+
+	policy := feature.MergePolicies(path.AllowedAttributes, authorizationResponse.Attributes)
+	queryLayers := wms.SplitLayers(queryParams.Get("query_layers"))
+	if !policy.Restricts(queryLayers...) {
+		return nil, ""
+	}
+
+	if !feature.IsFilterableFormat(queryParams.Get("info_format")) {
+		query := r.URL.Query()
+		query.Del(utils.QueryParamKey(query, "info_format"))
+		query.Set("INFO_FORMAT", "application/json")
+		r.URL.RawQuery = query.Encode()
+	}
+
+	featureLayer := ""
+	if len(queryLayers) == 1 {
+		featureLayer = queryLayers[0]
+	}
+
+	return policy, featureLayer
+}
+
+// getFeaturePolicy returns the attribute policy that applies to a WFS
+// GetFeature request, together with the queried type if there is only one.
+// The value reference of a GetPropertyValue request has to be allowed.
+// The properties requested through PROPERTYNAME or the PropertyName elements of
+// an XML request are restricted to the allowed properties, the features in the
+// response are filtered as well. Filters and sort orders may only refer to
+// allowed properties.
+func getFeaturePolicy(backend config.Backend, path config.Path, r *http.Request, body []byte, authorizationResponse *AuthorizationResponse) (int, string, feature.AttributePolicy, string, []byte) {
+	if backend.Type != "OWS" {
+		return http.StatusOK, "", nil, "", body
+	}
+
+	policy := feature.MergePolicies(path.AllowedAttributes, authorizationResponse.Attributes)
+
+	var typeNames []string
+	var outputFormat string
+	var valueReference string
+	var request string
+	var references error
+	if len(body) > 0 {
+		var getFeature wfs.GetFeature
+		if err := xml.Unmarshal(body, &getFeature); err != nil || (getFeature.XMLName.Local != "GetFeature" && getFeature.XMLName.Local != "GetPropertyValue") {
+			return http.StatusOK, "", nil, "", body
+		}
+
+		typeNames, outputFormat = getFeature.TypeNames(), getFeature.OutputFormat
+		request, valueReference = getFeature.XMLName.Local, getFeature.ValueReference
+		references = getFeature.CheckReferences(policy)
+	} else {
+		queryParams := utils.QueryParamsToLower(r.URL.Query())
+		request = queryParams.Get("request")
+		if queryParams.Get("service") != "WFS" || (!strings.EqualFold(request, "GetFeature") && !strings.EqualFold(request, "GetPropertyValue")) {
+			return http.StatusOK, "", nil, "", body
+		}
+
+		typeNames = wfs.QueryTypeNames(queryParams)
+		outputFormat = queryParams.Get("outputformat")
+		valueReference = queryParams.Get("valuereference")
+		references = wfs.CheckQueryReferences(typeNames, queryParams, policy)
+	}
+
+	// The request is authorized by the feature types it names, which it
+	// therefore has to name.
+	if len(typeNames) == 0 {
+		return http.StatusBadRequest, "type names are required", nil, "", body
+	}
+
+	if !policy.Restricts(typeNames...) {
+		return http.StatusOK, "", nil, "", body
+	}
+
+	// Hidden properties could be inferred from the features that a filter on
+	// them selects or from the order they are sorted in.
+	if references != nil {
+		log.Printf("rejected wfs %s: %s", request, references)
+		return http.StatusUnauthorized, "the filter or sort order refers to properties that are not authorized", nil, "", body
+	}
+
+	// A GetPropertyValue response contains the values of a single property,
+	// which only has to be checked against the policy.
+	if strings.EqualFold(request, "GetPropertyValue") {
+		property := strings.SplitN(valueReference, "/", 2)[0]
+		for _, typeName := range typeNames {
+			if !policy.Allows(typeName, property) {
+				return http.StatusUnauthorized, "the requested property is not authorized", nil, "", body
+			}
+		}
+
+		return http.StatusOK, "", nil, "", body
+	}
+
+	if outputFormat != "" && !feature.IsFilterableFormat(outputFormat) {
+		return http.StatusBadRequest, "output format can not be used for restricted feature types", nil, "", body
+	}
+
+	if len(body) > 0 {
+		projectedBody, err := wfs.ProjectGetFeature(body, policy)
+		if errors.Is(err, wfs.ErrNoAllowedProperties) {
+			return http.StatusUnauthorized, "none of the requested properties are authorized", nil, "", body
+		} else if err != nil {
+			return http.StatusBadRequest, "could not parse GetFeature request", nil, "", body
+		}
+
+		body = projectedBody
+	} else {
+		query := r.URL.Query()
+		key := utils.QueryParamKey(query, "propertyname")
+
+		propertyName, ok, err := wfs.ProjectPropertyNames(typeNames, query.Get(key), policy)
+		if err != nil {
+			return http.StatusUnauthorized, "none of the requested properties are authorized", nil, "", body
+		}
+
+		if ok {
+			query.Del(key)
+			query.Set("PROPERTYNAME", propertyName)
+			r.URL.RawQuery = query.Encode()
+		}
+	}
+
+	featureLayer := ""
+	if len(typeNames) == 1 {
+		featureLayer = typeNames[0]
+	}
+
+	return http.StatusOK, "", policy, featureLayer, body
+}
+
+// responseRewrite describes how a JSON response of a path is rewritten. Every
+// step is optional.
+type responseRewrite struct {
+	path         string
+	query        *gojq.Code
+	mode         string
+	selection    *fields.Selection
+	schema       *jsonschema.Schema
+	blockInvalid bool
+}
+
+// writeRewrittenResponse writes the output of a jq program for a JSON response,
+// with the status code of the response, of which only the selected fields are
+// kept and which is validated against the schema of the rewrite. Error
+// responses that are not JSON are replaced by an error of the proxy, so that
+// their content is never passed on unfiltered. Responses larger than maxSize
+// bytes are rejected, see readResponseBody.
+func writeRewrittenResponse(w http.ResponseWriter, r *http.Request, exceptions *ows.Exceptions, proxyResp *http.Response, rewrite responseRewrite, context jq.Context, maxSize int64) {
+	body, err := readResponseBody(proxyResp, maxSize)
+	if err != nil {
+		log.Printf("response of %s: %s", r.URL.Path, err)
+		writeServiceError(w, exceptions, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		w.Header().Set("Cache-Control", "private")
+		w.WriteHeader(proxyResp.StatusCode)
+		return
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		if proxyResp.StatusCode >= 400 {
+			writeServiceError(w, exceptions, proxyResp.StatusCode, http.StatusText(proxyResp.StatusCode))
+			return
+		}
+
+		writeServiceError(w, exceptions, http.StatusBadGateway, "could not parse backend response as json")
+		return
+	}
+
+	output := result
+	if rewrite.query != nil {
+		output, err = jq.Run(r.Context(), rewrite.query, result, context, rewrite.mode)
+		if err != nil {
+			log.Printf("could not rewrite response of %s: %s", r.URL.Path, err)
+			writeServiceError(w, exceptions, http.StatusBadGateway, "could not rewrite response")
+			return
+		}
+	}
+
+	if rewrite.selection != nil {
+		output = rewrite.selection.Apply(output)
+	}
+
+	if rewrite.schema != nil {
+		if violations := rewrite.schema.Validate(output); len(violations) > 0 {
+			invalidResponses.Add(rewrite.path, 1)
+			log.Printf("response of %s does not match the responseSchema: %s", r.URL.Path, joinViolations(violations))
+
+			if rewrite.blockInvalid {
+				writeServiceError(w, exceptions, http.StatusBadGateway, "backend response does not match the schema")
+				return
+			}
+		}
+	}
+
+	response, err := json.MarshalIndent(output, "", "    ")
+	if err != nil {
+		writeServiceError(w, exceptions, http.StatusInternalServerError, "could not marshal json")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private")
+	w.WriteHeader(proxyResp.StatusCode)
+	w.Write(response)
+}
+
+// writeStreamedResponse rewrites the elements of the array at path in a JSON
+// response one by one, and writes them as they are rewritten. Errors that
+// occur after the response has started abort it, so that the client does not
+// receive a truncated document as if it were complete. The members around the
+// array are rewritten by the responseStreamEnvelope of the path, or dropped.
+func writeStreamedResponse(w http.ResponseWriter, r *http.Request, exceptions *ows.Exceptions, proxyResp *http.Response, query *gojq.Code, path config.Path, context jq.Context, maxSize int64) {
+	stream, err := jq.NewStream(proxyResp.Body, path.ResponseStreamPath, path.ResponseStreamEnvelopeCode, maxSize)
+	if err != nil {
+		log.Printf("could not stream response of %s: %s", r.URL.Path, err)
+		writeServiceError(w, exceptions, http.StatusBadGateway, "could not parse backend response as json")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private")
+	w.WriteHeader(proxyResp.StatusCode)
+
+	if err := stream.Rewrite(r.Context(), query, context, w); err != nil {
+		log.Printf("could not rewrite streamed response of %s: %s", r.URL.Path, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeTransactionResponse returns the response to a wfs transaction with an
+// HTTP status code that matches its outcome. Exceptions are returned as JSON
+// when the client accepts JSON, or else as the exception document of the WFS
+// version of the transaction. When auditing is configured, a record of the
+// transaction is written as well.
+func writeTransactionResponse(w http.ResponseWriter, r *http.Request, proxyResp *http.Response, sink audit.Sink, transaction wfs.Transaction, username string, maxSize int64) {
+	body, err := readResponseBody(proxyResp, maxSize)
+	if err != nil {
+		log.Printf("response of %s: %s", r.URL.Path, err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	statusCode := proxyResp.StatusCode
+
+	response, err := wfs.ParseTransactionResponse(body)
+	var report *ows.ExceptionReport
+	if err != nil {
+		report, err = ows.ParseExceptionReport(body)
+		if err != nil {
+			report = &ows.ExceptionReport{Exceptions: []ows.Exception{{
+				Code: "NoApplicableCode",
+				Text: []string{fmt.Sprintf("invalid transaction response from backend (status %d)", proxyResp.StatusCode)},
+			}}}
+			statusCode = http.StatusBadGateway
+		} else {
+			statusCode = report.StatusCode()
+		}
+	} else if response.Status == "FAILED" {
+		report = &ows.ExceptionReport{Exceptions: []ows.Exception{{Code: "NoApplicableCode", Text: []string{response.Message}}}}
+		statusCode = report.StatusCode()
+	}
+
+	if sink != nil {
+		record := audit.Record{
+			Timestamp:  time.Now().UTC(),
+			Username:   username,
+			IP:         utils.ReadUserIP(r),
+			Path:       r.URL.Path,
+			Actions:    transaction.Summary(),
+			StatusCode: statusCode,
+			Response:   response,
+		}
+		if report != nil {
+			record.Error = report.Message()
+		}
+
+		if err := sink.Write(record); err != nil {
+			log.Printf("could not write audit record: %s", err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "private")
+
+	if acceptsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+
+		if report != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":    report.Message(),
+				"exceptions": report.Exceptions,
+			})
+		} else {
+			json.NewEncoder(w).Encode(response)
+		}
+		return
+	}
+
+	if report != nil {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(statusCode)
+		w.Write(report.WFS(transaction.Version))
+		return
+	}
+
+	utils.DelHopHeaders(proxyResp.Header)
+	utils.CopyHeader(w.Header(), proxyResp.Header)
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// acceptsJSON reports whether the client prefers a JSON response.
+func acceptsJSON(r *http.Request) bool {
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(mediaRange, ";")[0])
+		if mediaType == "application/json" {
+			return true
+		}
+		if mediaType == "text/xml" || mediaType == "application/xml" {
+			return false
+		}
+	}
+
+	return false
+}
+
+// writeVectorTile writes a vector tile after removing the layers that are not
+// authorized and the attributes that are not allowed by policy.
+func writeVectorTile(w http.ResponseWriter, exceptions *ows.Exceptions, proxyResp *http.Response, resources map[string]bool, policy feature.AttributePolicy, maxSize int64) {
+	body, err := readResponseBody(proxyResp, maxSize)
+	if err != nil {
+		log.Printf("could not filter vector tile: %s", err)
+		writeServiceError(w, exceptions, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	tile, err := mvt.Filter(body, resources, policy, maxSize)
+	if err != nil {
+		log.Printf("could not filter vector tile: %s", err)
+		writeServiceError(w, exceptions, http.StatusBadGateway, "could not filter backend response")
+		return
+	}
+
+	utils.DelHopHeaders(proxyResp.Header)
+	utils.CopyHeader(w.Header(), proxyResp.Header)
+	w.Header().Del("Content-Length")
+	w.Header().Del("ETag")
+	w.Header().Set("Cache-Control", "private")
+	w.WriteHeader(proxyResp.StatusCode)
+	w.Write(tile)
+}
+
+// writeOGCAPIResponse writes a JSON response of an OGC API - Features backend
+// after removing the collections that are not authorized from a collections
+// listing, removing the properties that are not allowed by policy from
+// features, and rewriting links to the backend into links to the proxy at
+// publicURL.
+func writeOGCAPIResponse(w http.ResponseWriter, r *http.Request, exceptions *ows.Exceptions, proxyResp *http.Response, backendURL *url.URL, publicURL string, request ogcapi.Request, policy feature.AttributePolicy, resources map[string]bool, maxSize int64) {
+	body, err := readResponseBody(proxyResp, maxSize)
+	if err != nil {
+		log.Printf("response of %s: %s", r.URL.Path, err)
+		writeServiceError(w, exceptions, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if !strings.Contains(strings.ToLower(proxyResp.Header.Get("Content-Type")), "json") {
+		if policy != nil || request.Kind == "collections" {
+			writeServiceError(w, exceptions, http.StatusBadGateway, "could not filter backend response")
+			return
+		}
+
+		utils.DelHopHeaders(proxyResp.Header)
+		utils.CopyHeader(w.Header(), proxyResp.Header)
+		w.Header().Set("Cache-Control", "private")
+		w.WriteHeader(proxyResp.StatusCode)
+		w.Write(body)
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		writeServiceError(w, exceptions, http.StatusBadGateway, "could not parse backend response")
+		return
+	}
+
+	if request.Kind == "collections" {
+		ogcapi.FilterCollections(document, resources)
+	}
+
+	if policy != nil {
+		if err := feature.FilterFeatures(document, policy, request.Collection); err != nil {
+			writeServiceError(w, exceptions, http.StatusBadGateway, "could not filter backend response")
+			return
+		}
+	}
+
+	proxyPrefix, backendPrefix := ogcapi.Prefixes(r.URL.Path, backendURL.Path)
+
+	ogcapi.RewriteLinks(document, backendURL.Scheme+"://"+backendURL.Host+backendPrefix, publicURL+proxyPrefix)
+
+	response, err := json.Marshal(document)
+	if err != nil {
+		writeServiceError(w, exceptions, http.StatusInternalServerError, "could not marshal json")
+		return
+	}
+
+	utils.DelHopHeaders(proxyResp.Header)
+	utils.CopyHeader(w.Header(), proxyResp.Header)
+	w.Header().Del("Content-Length")
+	w.Header().Set("Cache-Control", "private")
+	w.WriteHeader(proxyResp.StatusCode)
+	w.Write(response)
+}
+
+// publicBaseURL returns the scheme and host under which a client reached the
+// proxy: the configured publicUrl, or else those of the request. The
+// X-Forwarded-Proto and X-Forwarded-Host headers are only honoured for
+// requests of trusted proxies, as clients could otherwise have the proxy
+// return links to a host of their choice.
+func publicBaseURL(config *config.Config, r *http.Request) string {
+	if config.PublicURL != "" {
+		return strings.TrimSuffix(config.PublicURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if config.TrustedProxy(r.RemoteAddr) {
+		if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+
+		if forwardedHost := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0]); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+
+	return scheme + "://" + host
+}
+
+// writeFilteredFeatures writes a backend response containing GeoJSON or GML
+// features after removing the properties that are not allowed by policy.
+func writeFilteredFeatures(w http.ResponseWriter, exceptions *ows.Exceptions, proxyResp *http.Response, policy feature.AttributePolicy, defaultLayer string, maxSize int64) {
+	body, err := readResponseBody(proxyResp, maxSize)
+	if err != nil {
+		log.Printf("could not filter features in backend response: %s", err)
+		writeServiceError(w, exceptions, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	filtered, err := feature.Filter(body, proxyResp.Header.Get("Content-Type"), policy, defaultLayer)
+	if err != nil {
+		log.Printf("could not filter features in backend response: %s", err)
+		writeServiceError(w, exceptions, http.StatusBadGateway, "could not filter backend response")
+		return
+	}
+
+	utils.DelHopHeaders(proxyResp.Header)
+	proxyResp.Header.Del("Content-Length")
+	utils.CopyHeader(w.Header(), proxyResp.Header)
+	w.Header().Set("Cache-Control", "private")
+	w.WriteHeader(proxyResp.StatusCode)
+	w.Write(filtered)
+}
+
+// readResponseBody reads a backend response that is processed in memory.
+// Responses larger than maxSize bytes are rejected, unless maxSize is zero.
+func readResponseBody(proxyResp *http.Response, maxSize int64) ([]byte, error) {
+	reader := io.Reader(proxyResp.Body)
+	if maxSize > 0 {
+		reader = io.LimitReader(proxyResp.Body, maxSize+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.New("could not read backend response")
+	}
+
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("backend response exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	return body, nil
+}
+
+// writeServiceError writes an error as an exception report in the format and
+// version requested by the client for OWS and WMTS backends, and as JSON for
+// other backends.
+func writeServiceError(w http.ResponseWriter, exceptions *ows.Exceptions, statusCode int, message string) {
+	if exceptions == nil {
+		writeError(w, statusCode, message)
+		return
+	}
+
+	exceptions.Write(w, statusCode, ows.ExceptionReport{Exceptions: []ows.Exception{{
+		Code: ows.CodeForStatus(statusCode),
+		Text: []string{message},
+	}}})
+}
+
+// validateRequestBody returns the violations of the schema by a request body,
+// or a single violation when the body is not JSON.
+func validateRequestBody(schema *jsonschema.Schema, body []byte) []jsonschema.Violation {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return []jsonschema.Violation{{Message: "request body is not valid json"}}
+	}
+
+	return schema.Validate(document)
+}
+
+// writeViolations rejects a request that does not match the requestSchema or
+// the OpenAPI operation of its path.
+func writeViolations(w http.ResponseWriter, violations []jsonschema.Violation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "request does not match the schema",
+		"violations": violations,
+	})
+}
+
+func joinViolations(violations []jsonschema.Violation) string {
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.String()
+	}
+
+	return strings.Join(messages, "; ")
 }
 
 func writeError(w http.ResponseWriter, statusCode int, message string) {
@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/delta10/filter-proxy/internal/config"
+	"github.com/delta10/filter-proxy/internal/utils"
+	"github.com/delta10/filter-proxy/internal/wfs"
+)
+
+// Record describes a WFS transaction that was forwarded to a backend.
+type Record struct {
+	Timestamp  time.Time                `json:"timestamp"`
+	Username   string                   `json:"username"`
+	IP         string                   `json:"ip"`
+	Path       string                   `json:"path"`
+	Actions    []wfs.ActionSummary      `json:"actions"`
+	StatusCode int                      `json:"statusCode"`
+	Response   *wfs.TransactionResponse `json:"response,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+// defaultQueueSize is the number of records that a webhook sink holds while
+// they are being sent, when the configuration does not set it.
+const defaultQueueSize = 1000
+
+// droppedRecords counts the audit records that could not be delivered, because
+// the queue of a webhook sink was full or the webhook failed.
+var droppedRecords = expvar.NewInt("droppedAuditRecords")
+
+var errQueueFull = errors.New("audit queue is full, record dropped")
+
+// Sink stores audit records.
+type Sink interface {
+	Write(record Record) error
+}
+
+// NewSink returns the sink configured in audit, or nil when auditing is not
+// configured.
+func NewSink(audit config.Audit) (Sink, error) {
+	switch audit.Sink {
+	case "":
+		return nil, nil
+	case "stdout":
+		return &writerSink{writer: os.Stdout}, nil
+	case "file":
+		if audit.File == "" {
+			return nil, fmt.Errorf("audit sink file requires a file")
+		}
+
+		file, err := os.OpenFile(audit.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, err
+		}
+
+		return &writerSink{writer: file}, nil
+	case "webhook":
+		if audit.URL == "" {
+			return nil, fmt.Errorf("audit sink webhook requires a url")
+		}
+
+		headers := map[string]string{}
+		for key, value := range audit.Headers {
+			headers[key] = utils.EnvSubst(value, nil)
+		}
+
+		queueSize := audit.QueueSize
+		if queueSize <= 0 {
+			queueSize = defaultQueueSize
+		}
+
+		sink := &webhookSink{
+			url:     audit.URL,
+			headers: headers,
+			client:  &http.Client{Timeout: 10 * time.Second},
+			queue:   make(chan Record, queueSize),
+		}
+		go sink.run()
+
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink: %s", audit.Sink)
+	}
+}
+
+// writerSink writes every record as a line of JSON.
+type writerSink struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func (s *writerSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.writer.Write(append(line, '\n'))
+	return err
+}
+
+// webhookSink posts every record as JSON to a URL. Records are queued and
+// sent in the background, so that a slow webhook does not delay responses.
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	queue   chan Record
+}
+
+// Write queues a record, or drops it when the queue is full.
+func (s *webhookSink) Write(record Record) error {
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		droppedRecords.Add(1)
+		return errQueueFull
+	}
+}
+
+// run sends the queued records one by one.
+func (s *webhookSink) run() {
+	for record := range s.queue {
+		if err := s.post(record); err != nil {
+			droppedRecords.Add(1)
+			log.Printf("could not send audit record of %s by %s: %s", record.Path, record.Username, err)
+		}
+	}
+}
+
+func (s *webhookSink) post(record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned status %d", response.StatusCode)
+	}
+
+	return nil
+}
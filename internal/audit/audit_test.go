@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delta10/filter-proxy/internal/config"
+)
+
+func TestNewSink(t *testing.T) {
+	tests := []struct {
+		name  string
+		audit config.Audit
+		err   string
+	}{
+		{"not configured", config.Audit{}, ""},
+		{"file without a file", config.Audit{Sink: "file"}, "requires a file"},
+		{"webhook without a url", config.Audit{Sink: "webhook"}, "requires a url"},
+		{"unknown", config.Audit{Sink: "syslog"}, "unknown audit sink"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink, err := NewSink(test.audit)
+			if test.err == "" {
+				if err != nil || sink != nil {
+					t.Errorf("NewSink() = %v, %v, want no sink", sink, err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("NewSink() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewSink(config.Audit{Sink: "file", File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, username := range []string{"a", "b"} {
+		if err := sink.Write(Record{Timestamp: time.Unix(0, 0), Username: username, StatusCode: http.StatusOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(written)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2: %s", len(lines), written)
+	}
+
+	var record Record
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil || record.Username != "b" {
+		t.Errorf("got record %s (%v)", lines[1], err)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	t.Setenv("TEST_AUDIT_TOKEN", "geheim")
+
+	received := make(chan Record)
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record Record
+		json.NewDecoder(r.Body).Decode(&record)
+		authorization = r.Header.Get("Authorization")
+
+		if record.Username == "fout" {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		received <- record
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(config.Audit{Sink: "webhook", URL: server.URL, Headers: map[string]string{"Authorization": "Bearer ${TEST_AUDIT_TOKEN}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Write(Record{Username: "a", Path: "/wfs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case record := <-received:
+		if record.Username != "a" || record.Path != "/wfs" || authorization != "Bearer geheim" {
+			t.Errorf("webhook received %+v with authorization %q", record, authorization)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the record was not sent")
+	}
+
+	// A failing webhook does not fail the write, but the record is counted as
+	// dropped.
+	dropped := droppedRecords.Value()
+	if err := sink.Write(Record{Username: "fout"}); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+
+	for start := time.Now(); droppedRecords.Value() == dropped; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the rejected record was not counted as dropped")
+		}
+	}
+}
+
+func TestWebhookSinkQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// The first record is being sent, the second waits in the queue and the
+	// third does not fit.
+	sink, err := NewSink(config.Audit{Sink: "webhook", URL: server.URL, QueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropped := droppedRecords.Value()
+
+	var errs []error
+	for start := time.Now(); len(errs) == 0 && time.Since(start) < 5*time.Second; {
+		if err := sink.Write(Record{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 || errs[0] != errQueueFull {
+		t.Fatalf("got errors %v, want the queue to be full", errs)
+	}
+
+	if droppedRecords.Value() != dropped+1 {
+		t.Errorf("dropped records = %d, want %d", droppedRecords.Value(), dropped+1)
+	}
+}
@@ -1,14 +1,30 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/itchyny/gojq"
 	"gopkg.in/yaml.v2"
+
+	"github.com/delta10/filter-proxy/internal/fields"
+	"github.com/delta10/filter-proxy/internal/jq"
+	"github.com/delta10/filter-proxy/internal/jsonschema"
+	"github.com/delta10/filter-proxy/internal/openapi"
+	"github.com/delta10/filter-proxy/internal/utils"
 )
 
 type Backend struct {
 	Type    string `yaml:"type"`
 	BaseURL string `yaml:"baseUrl"`
+	OpenAPI string `yaml:"openapi"`
 
 	Auth struct {
 		Header map[string]string `yaml:"header"`
@@ -32,8 +48,194 @@ type Path struct {
 		Slug string `yaml:"slug"`
 		Path string `yaml:"path"`
 	} `yaml:"backend"`
-	RequestRewrite  string `yaml:"requestRewrite"`
-	ResponseRewrite string `yaml:"responseRewrite"`
+	RequestRewrite         string                       `yaml:"requestRewrite"`
+	ResponseRewrite        string                       `yaml:"responseRewrite"`
+	ResponseRewriteOutput  string                       `yaml:"responseRewriteOutput"`
+	ResponseRewriteStatus  []string                     `yaml:"responseRewriteStatus"`
+	ErrorRewrite           string                       `yaml:"errorRewrite"`
+	ErrorRewriteStatus     []string                     `yaml:"errorRewriteStatus"`
+	ResponseStream         string                       `yaml:"responseStream"`
+	ResponseStreamEnvelope string                       `yaml:"responseStreamEnvelope"`
+	ResponseFields         *Fields                      `yaml:"responseFields"`
+	RequestSchema          string                       `yaml:"requestSchema"`
+	ResponseSchema         string                       `yaml:"responseSchema"`
+	BlockInvalidResponses  bool                         `yaml:"blockInvalidResponses"`
+	OpenAPI                *OpenAPIRoutes               `yaml:"openapi"`
+	AllowedQueryParams     map[string]string            `yaml:"allowedQueryParams"`
+	DefaultQueryParams     map[string]string            `yaml:"defaultQueryParams"`
+	ForcedQueryParams      map[string]string            `yaml:"forcedQueryParams"`
+	RenameQueryParams      map[string]string            `yaml:"renameQueryParams"`
+	DropUnauthorizedLayers bool                         `yaml:"dropUnauthorizedLayers"`
+	AllowedAttributes      map[string][]string          `yaml:"allowedAttributes"`
+	WritableAttributes     map[string][]string          `yaml:"writableAttributes"`
+	InjectAttributes       map[string]map[string]string `yaml:"injectAttributes"`
+	GeometryProperties     map[string]string            `yaml:"geometryProperties"`
+	AllowNativeActions     bool                         `yaml:"allowNativeActions"`
+	AllowedReferences      []string                     `yaml:"allowedReferences"`
+
+	// The compiled requestRewrite, responseRewrite, responseStreamEnvelope and
+	// errorRewrite programs.
+	RequestRewriteCode         *gojq.Code `yaml:"-"`
+	ResponseRewriteCode        *gojq.Code `yaml:"-"`
+	ResponseStreamEnvelopeCode *gojq.Code `yaml:"-"`
+	ErrorRewriteCode           *gojq.Code `yaml:"-"`
+
+	// The keys of the parsed responseStream path.
+	ResponseStreamPath []string `yaml:"-"`
+	// The parsed responseFields.
+	ResponseFieldsSelection *fields.Selection `yaml:"-"`
+	// The loaded requestSchema and responseSchema.
+	RequestSchemaValidator  *jsonschema.Schema `yaml:"-"`
+	ResponseSchemaValidator *jsonschema.Schema `yaml:"-"`
+	// The operations of the OpenAPI document of the backend a generated path
+	// serves, by method.
+	Operations map[string]*openapi.Operation `yaml:"-"`
+	// The filtered OpenAPI document, as JSON, that a generated path publishes.
+	Spec []byte `yaml:"-"`
+	// The compiled value patterns of allowedQueryParams.
+	QueryParamPatterns map[string]*regexp.Regexp `yaml:"-"`
+}
+
+// CheckQuery returns an error for a query parameter of a request that is not
+// in the allowedQueryParams of the path, or of which a value does not match
+// its pattern. All parameters are allowed when the path has no
+// allowedQueryParams. Names are compared case-insensitively, as OWS services
+// do.
+func (p Path) CheckQuery(query url.Values) error {
+	if p.AllowedQueryParams == nil {
+		return nil
+	}
+
+	for name, values := range query {
+		allowed, ok := foldKey(p.AllowedQueryParams, name)
+		if !ok {
+			return fmt.Errorf("query parameter %s is not allowed", name)
+		}
+
+		pattern := p.QueryParamPatterns[allowed]
+		for _, value := range values {
+			if pattern != nil && !pattern.MatchString(value) {
+				return fmt.Errorf("value of query parameter %s is not allowed", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// BackendQuery returns the query parameters to send to the backend for the
+// query of a request: renamed, completed with the default parameters the
+// request does not have, and with the forced parameters overriding those of
+// the request. Default and forced values are templates of which ${NAME} is
+// replaced by the value of a replacement or environment variable. Names are
+// compared case-insensitively, so that a forced parameter can not be
+// overridden by a parameter of the request in another case.
+func (p Path) BackendQuery(query url.Values, replacements map[string]string) url.Values {
+	backendQuery := url.Values{}
+	for name, values := range query {
+		if renamed, ok := foldKey(p.RenameQueryParams, name); ok {
+			name = p.RenameQueryParams[renamed]
+		}
+		backendQuery[name] = append(backendQuery[name], values...)
+	}
+
+	for name, value := range p.DefaultQueryParams {
+		if _, ok := foldKey(backendQuery, name); !ok {
+			backendQuery.Set(name, utils.EnvSubst(value, replacements))
+		}
+	}
+
+	for name, value := range p.ForcedQueryParams {
+		for existing := range backendQuery {
+			if strings.EqualFold(existing, name) {
+				delete(backendQuery, existing)
+			}
+		}
+		backendQuery.Set(name, utils.EnvSubst(value, replacements))
+	}
+
+	return backendQuery
+}
+
+// foldKey returns the key of m that is equal to name under case folding,
+// preferring an exact match.
+func foldKey[V any](m map[string]V, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// OpenAPIRoutes generates a path for every path of the OpenAPI document of the
+// backend, under the path and backend path of the configured path, which are
+// prefixes then. The generated paths allow the methods of the operations and
+// validate requests against them, and have the other settings of the
+// configured path.
+type OpenAPIRoutes struct {
+	// Operations are the operation ids of the operations to expose, or empty to
+	// expose only the GET operations.
+	Operations []string `yaml:"operations"`
+	// SpecPath is the path at which the document is published, with only the
+	// exposed operations.
+	SpecPath string `yaml:"specPath"`
+}
+
+// Fields are the paths of the fields of a JSON response that are passed on to
+// the client, as an alternative to a responseRewrite.
+type Fields struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// RewritesResponse reports whether the responseRewrite of the path applies to
+// a response with statusCode. By default only 200 responses are rewritten.
+func (p Path) RewritesResponse(statusCode int) bool {
+	return matchStatus(p.ResponseRewriteStatus, []string{"200"}, statusCode)
+}
+
+// RewritesError reports whether the errorRewrite of the path applies to a
+// response with statusCode. By default all 4xx and 5xx responses are
+// rewritten.
+func (p Path) RewritesError(statusCode int) bool {
+	return p.ErrorRewrite != "" && matchStatus(p.ErrorRewriteStatus, []string{"4xx", "5xx"}, statusCode)
+}
+
+// matchStatus reports whether statusCode matches one of the patterns, which
+// are status codes such as 201 or classes such as 2xx.
+func matchStatus(patterns []string, defaults []string, statusCode int) bool {
+	if len(patterns) == 0 {
+		patterns = defaults
+	}
+
+	code := strconv.Itoa(statusCode)
+	for _, pattern := range patterns {
+		if pattern == code || (strings.HasSuffix(pattern, "xx") && len(pattern) == 3 && pattern[0] == code[0]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validStatus(patterns []string) error {
+	for _, pattern := range patterns {
+		if len(pattern) != 3 || pattern[0] < '1' || pattern[0] > '5' {
+			return fmt.Errorf("invalid status code %q", pattern)
+		}
+
+		if _, err := strconv.Atoi(pattern); err != nil && pattern[1:] != "xx" {
+			return fmt.Errorf("invalid status code %q", pattern)
+		}
+	}
+
+	return nil
 }
 
 type Cors struct {
@@ -45,6 +247,17 @@ type Cors struct {
 	DebugLogging        bool     `yaml:"debugLogging"`
 }
 
+// Audit configures where records of WFS transactions are written: a file of
+// JSON lines, stdout or a webhook. QueueSize is the number of records a
+// webhook holds while they are being sent.
+type Audit struct {
+	Sink      string            `yaml:"sink"`
+	File      string            `yaml:"file"`
+	URL       string            `yaml:"url"`
+	Headers   map[string]string `yaml:"headers"`
+	QueueSize int               `yaml:"queueSize"`
+}
+
 type Config struct {
 	ListenAddress string `yaml:"listenAddress"`
 	ListenTLS     struct {
@@ -53,9 +266,46 @@ type Config struct {
 	} `yaml:"listenTls"`
 	AuthorizationServiceURL string             `yaml:"authorizationServiceUrl"`
 	JwksURL                 string             `yaml:"jwksUrl"`
+	JwksIssuer              string             `yaml:"jwksIssuer"`
+	JwksAudience            string             `yaml:"jwksAudience"`
 	Paths                   []Path             `yaml:"paths"`
 	Backends                map[string]Backend `yaml:"backends"`
 	Cors                    Cors               `yaml:"cors"`
+	Audit                   Audit              `yaml:"audit"`
+	JqCacheSize             int                `yaml:"jqCacheSize"`
+	JqHashKey               string             `yaml:"jqHashKey"`
+	JqEnv                   []string           `yaml:"jqEnv"`
+	MaxResponseBodySize     int64              `yaml:"maxResponseBodySize"`
+	ExpvarListenAddress     string             `yaml:"expvarListenAddress"`
+	PublicURL               string             `yaml:"publicUrl"`
+	TrustedProxies          []string           `yaml:"trustedProxies"`
+
+	// JqEnvironment holds the variables of JqEnv, read once at startup
+	JqEnvironment map[string]string `yaml:"-"`
+	// TrustedProxyNetworks holds the parsed addresses of TrustedProxies
+	TrustedProxyNetworks []*net.IPNet `yaml:"-"`
+}
+
+// TrustedProxy reports whether a request with remoteAddr comes from one of the
+// trustedProxies, of which the X-Forwarded headers are honoured.
+func (c *Config) TrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range c.TrustedProxyNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // NewConfig returns a new decoded Config struct
@@ -78,5 +328,230 @@ func NewConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	if config.JqHashKey != "" {
+		config.JqHashKey = utils.EnvSubst(config.JqHashKey, nil)
+		if config.JqHashKey == "" || strings.Contains(config.JqHashKey, "${") {
+			return nil, fmt.Errorf("jqHashKey is configured but empty or refers to an unset environment variable")
+		}
+	}
+	config.JqEnvironment = jq.Environment(config.JqEnv)
+
+	if config.PublicURL != "" {
+		publicURL, err := url.Parse(config.PublicURL)
+		if err != nil || (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" {
+			return nil, fmt.Errorf("publicUrl %q is not an absolute http or https URL", config.PublicURL)
+		}
+	}
+
+	// Trusted proxies are single addresses or networks in CIDR notation.
+	for _, proxy := range config.TrustedProxies {
+		cidr := proxy
+		if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else if ip != nil {
+			cidr += "/128"
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trustedProxies address %q: %w", proxy, err)
+		}
+		config.TrustedProxyNetworks = append(config.TrustedProxyNetworks, network)
+	}
+
+	// Compile jq programs once, so that invalid programs are reported at startup
+	for i := range config.Paths {
+		path := &config.Paths[i]
+
+		if path.RequestRewrite != "" {
+			if path.RequestRewriteCode, err = jq.Compile(path.RequestRewrite, []byte(config.JqHashKey)); err != nil {
+				return nil, fmt.Errorf("invalid requestRewrite for path %s: %w", path.Path, err)
+			}
+		}
+
+		if err := jq.ValidOutput(path.ResponseRewriteOutput); err != nil {
+			return nil, fmt.Errorf("invalid responseRewriteOutput for path %s: %w", path.Path, err)
+		}
+
+		if path.ResponseRewrite != "" {
+			if path.ResponseRewriteCode, err = jq.Compile(path.ResponseRewrite, []byte(config.JqHashKey)); err != nil {
+				return nil, fmt.Errorf("invalid responseRewrite for path %s: %w", path.Path, err)
+			}
+		}
+
+		if path.ErrorRewrite != "" {
+			if path.ErrorRewriteCode, err = jq.Compile(path.ErrorRewrite, []byte(config.JqHashKey)); err != nil {
+				return nil, fmt.Errorf("invalid errorRewrite for path %s: %w", path.Path, err)
+			}
+		}
+
+		if path.ResponseStream != "" {
+			if path.ResponseRewrite == "" {
+				return nil, fmt.Errorf("responseStream for path %s requires a responseRewrite", path.Path)
+			}
+
+			if path.ResponseStreamPath, err = jq.ParseArrayPath(path.ResponseStream); err != nil {
+				return nil, fmt.Errorf("invalid responseStream for path %s: %w", path.Path, err)
+			}
+		}
+
+		if path.ResponseStreamEnvelope != "" {
+			if path.ResponseStream == "" {
+				return nil, fmt.Errorf("responseStreamEnvelope for path %s requires a responseStream", path.Path)
+			}
+
+			if path.ResponseStreamEnvelopeCode, err = jq.Compile(path.ResponseStreamEnvelope, []byte(config.JqHashKey)); err != nil {
+				return nil, fmt.Errorf("invalid responseStreamEnvelope for path %s: %w", path.Path, err)
+			}
+		}
+
+		if path.ResponseFields != nil {
+			if path.ResponseStream != "" {
+				return nil, fmt.Errorf("responseFields for path %s can not be combined with a responseStream", path.Path)
+			}
+
+			if path.ResponseFieldsSelection, err = fields.Parse(path.ResponseFields.Include, path.ResponseFields.Exclude); err != nil {
+				return nil, fmt.Errorf("invalid responseFields for path %s: %w", path.Path, err)
+			}
+		}
+
+		if path.RequestSchema != "" {
+			if path.RequestSchemaValidator, err = jsonschema.Load(path.RequestSchema); err != nil {
+				return nil, fmt.Errorf("invalid requestSchema for path %s: %w", path.Path, err)
+			}
+		}
+
+		if path.ResponseSchema != "" {
+			if path.ResponseStream != "" {
+				return nil, fmt.Errorf("responseSchema for path %s can not be combined with a responseStream", path.Path)
+			}
+
+			if path.ResponseSchemaValidator, err = jsonschema.Load(path.ResponseSchema); err != nil {
+				return nil, fmt.Errorf("invalid responseSchema for path %s: %w", path.Path, err)
+			}
+		}
+
+		for name, pattern := range path.AllowedQueryParams {
+			if pattern == "" {
+				continue
+			}
+
+			compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowedQueryParams pattern of %s for path %s: %w", name, path.Path, err)
+			}
+
+			if path.QueryParamPatterns == nil {
+				path.QueryParamPatterns = map[string]*regexp.Regexp{}
+			}
+			path.QueryParamPatterns[name] = compiled
+		}
+
+		if err := validStatus(path.ResponseRewriteStatus); err != nil {
+			return nil, fmt.Errorf("invalid responseRewriteStatus for path %s: %w", path.Path, err)
+		}
+
+		if err := validStatus(path.ErrorRewriteStatus); err != nil {
+			return nil, fmt.Errorf("invalid errorRewriteStatus for path %s: %w", path.Path, err)
+		}
+	}
+
+	var paths []Path
+	for _, path := range config.Paths {
+		if path.OpenAPI == nil {
+			paths = append(paths, path)
+			continue
+		}
+
+		generated, err := generatePaths(path, config.Backends[path.Backend.Slug])
+		if err != nil {
+			return nil, fmt.Errorf("invalid openapi for path %s: %w", path.Path, err)
+		}
+		paths = append(paths, generated...)
+	}
+	config.Paths = paths
+
 	return config, nil
 }
+
+// generatePaths returns the paths of the operations of the OpenAPI document of
+// the backend that a path exposes, and the path that publishes the document.
+func generatePaths(path Path, backend Backend) ([]Path, error) {
+	if backend.OpenAPI == "" {
+		return nil, fmt.Errorf("backend %s has no openapi document", path.Backend.Slug)
+	}
+
+	document, err := openapi.Load(backend.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := document.Operations()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(path.OpenAPI.Operations) > 0 {
+		exposed := map[string]bool{}
+		for _, id := range path.OpenAPI.Operations {
+			exposed[id] = true
+		}
+
+		var selected []openapi.Operation
+		for _, operation := range operations {
+			if exposed[operation.ID] {
+				selected = append(selected, operation)
+				delete(exposed, operation.ID)
+			}
+		}
+
+		for id := range exposed {
+			return nil, fmt.Errorf("unknown operation %s", id)
+		}
+
+		operations = selected
+	} else {
+		var selected []openapi.Operation
+		for _, operation := range operations {
+			if operation.Method == http.MethodGet {
+				selected = append(selected, operation)
+			}
+		}
+
+		operations = selected
+	}
+
+	var paths []Path
+	byTemplate := map[string]int{}
+	for i := range operations {
+		operation := &operations[i]
+
+		index, ok := byTemplate[operation.Path]
+		if !ok {
+			generated := path
+			generated.OpenAPI = nil
+			generated.Path = strings.TrimSuffix(path.Path, "/") + operation.Template()
+			generated.Backend.Path = strings.TrimSuffix(path.Backend.Path, "/") + operation.Template()
+			generated.AllowedMethods = nil
+			generated.Operations = map[string]*openapi.Operation{}
+
+			index = len(paths)
+			byTemplate[operation.Path] = index
+			paths = append(paths, generated)
+		}
+
+		paths[index].AllowedMethods = append(paths[index].AllowedMethods, operation.Method)
+		paths[index].Operations[operation.Method] = operation
+	}
+
+	if path.OpenAPI.SpecPath != "" {
+		spec, err := json.Marshal(document.Filter(operations, strings.TrimSuffix(path.Path, "/")))
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, Path{Path: path.OpenAPI.SpecPath, Spec: spec})
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadConfig writes document to a file and loads it as a config.
+func loadConfig(t *testing.T, document string) (*Config, error) {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(document), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewConfig(configPath)
+}
+
+func TestJqHashKey(t *testing.T) {
+	t.Setenv("TEST_JQ_HASH_KEY", "sleutel")
+	t.Setenv("TEST_EMPTY_JQ_HASH_KEY", "")
+
+	tests := []struct {
+		name     string
+		document string
+		err      string
+	}{
+		{"from the environment", "jqHashKey: ${TEST_JQ_HASH_KEY}\npaths:\n  - path: /a\n    responseRewrite: .bsn | hash\n", ""},
+		{"unset variable", "jqHashKey: ${TEST_UNSET_JQ_HASH_KEY}\n", "jqHashKey"},
+		{"empty variable", "jqHashKey: ${TEST_EMPTY_JQ_HASH_KEY}\n", "jqHashKey"},
+		{"hash without a key", "paths:\n  - path: /a\n    responseRewrite: .bsn | hash\n", "invalid responseRewrite"},
+		{"no key and no hash", "paths:\n  - path: /a\n    responseRewrite: .bsn | mask(4)\n", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, test.document)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("NewConfig() error = %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("NewConfig() error = %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestOpenAPIOperations(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "openapi.yaml")
+	err := os.WriteFile(spec, []byte(`
+openapi: 3.0.3
+paths:
+  /zaken:
+    get:
+      operationId: ListZaken
+    post:
+      operationId: CreateZaak
+  /zaken/{id}:
+    delete:
+      operationId: DeleteZaak
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		operations string
+		want       map[string][]string
+		err        string
+	}{
+		{"only get by default", "", map[string][]string{"/api/zaken": {"GET"}}, ""},
+		{"listed operations", "operations: [CreateZaak, DeleteZaak]", map[string][]string{"/api/zaken": {"POST"}, "/api/zaken/{id}": {"DELETE"}}, ""},
+		{"unknown operation", "operations: [UpdateZaak]", nil, "unknown operation UpdateZaak"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadConfig(t, `
+backends:
+  zaken:
+    baseUrl: http://localhost:8000
+    openapi: `+spec+`
+paths:
+  - path: /api
+    backend:
+      slug: zaken
+      path: /
+    openapi: {`+test.operations+`}
+`)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("NewConfig() error = %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			methods := map[string][]string{}
+			for _, path := range config.Paths {
+				methods[path.Path] = path.AllowedMethods
+			}
+
+			if !reflect.DeepEqual(methods, test.want) {
+				t.Errorf("generated paths %v, want %v", methods, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckQuery(t *testing.T) {
+	config, err := loadConfig(t, `
+paths:
+  - path: /wms
+    allowedQueryParams:
+      SERVICE: ""
+      request: "GetMap|GetCapabilities"
+      layers: ""
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := config.Paths[0]
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"service=WMS&REQUEST=GetMap&Layers=wegen", ""},
+		{"Service=WMS&request=GetCapabilities", ""},
+		{"service=WMS&request=GetFeatureInfo", "value of query parameter request is not allowed"},
+		{"service=WMS&Request=GetFeatureInfo", "value of query parameter Request is not allowed"},
+		{"service=WMS&cql_filter=1=1", "query parameter cql_filter is not allowed"},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+
+		err := path.CheckQuery(query)
+		if test.err == "" && err != nil {
+			t.Errorf("CheckQuery(%s) error = %s", test.query, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("CheckQuery(%s) error = %v, want %q", test.query, err, test.err)
+		}
+	}
+}
+
+func TestBackendQuery(t *testing.T) {
+	t.Setenv("TEST_GEMEENTE", "0363")
+
+	path := Path{
+		RenameQueryParams:  map[string]string{"velden": "fields"},
+		DefaultQueryParams: map[string]string{"fields": "identificatie", "pageSize": "20"},
+		ForcedQueryParams:  map[string]string{"CQL_FILTER": "gemeente='${TEST_GEMEENTE}'", "eigenaar": "${REQUEST_USERNAME}", "zaak": "${id}"},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  url.Values
+	}{
+		{
+			"defaults and forced",
+			"",
+			url.Values{"fields": {"identificatie"}, "pageSize": {"20"}, "CQL_FILTER": {"gemeente='0363'"}, "eigenaar": {"gebruiker"}, "zaak": {"1"}},
+		},
+		{
+			"renamed parameter replaces a default",
+			"Velden=naam",
+			url.Values{"fields": {"naam"}, "pageSize": {"20"}, "CQL_FILTER": {"gemeente='0363'"}, "eigenaar": {"gebruiker"}, "zaak": {"1"}},
+		},
+		{
+			"forced parameter in another case",
+			"cql_filter=1=1&PAGESIZE=5&Eigenaar=iemand",
+			url.Values{"fields": {"identificatie"}, "PAGESIZE": {"5"}, "CQL_FILTER": {"gemeente='0363'"}, "eigenaar": {"gebruiker"}, "zaak": {"1"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(test.query)
+
+			got := path.BackendQuery(query, map[string]string{"id": "1", "REQUEST_USERNAME": "gebruiker"})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("BackendQuery() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	config, err := loadConfig(t, "trustedProxies: [\"10.0.0.0/8\", \"192.168.1.1\", \"::1\"]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"10.1.2.3:1234":    true,
+		"192.168.1.1:80":   true,
+		"192.168.1.2:80":   false,
+		"[::1]:8080":       true,
+		"172.16.0.1:443":   false,
+		"not an address":   false,
+		"10.1.2.3":         true,
+		"[2001:db8::1]:80": false,
+	}
+
+	for remoteAddr, want := range tests {
+		if got := config.TrustedProxy(remoteAddr); got != want {
+			t.Errorf("TrustedProxy(%q) = %t, want %t", remoteAddr, got, want)
+		}
+	}
+
+	for _, document := range []string{"trustedProxies: [\"proxy\"]\n", "publicUrl: proxy.example.com\n"} {
+		if _, err := loadConfig(t, document); err == nil {
+			t.Errorf("NewConfig(%q) succeeded, want an error", document)
+		}
+	}
+}
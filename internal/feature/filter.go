@@ -0,0 +1,30 @@
+package feature
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnsupportedFormat = errors.New("feature format can not be filtered")
+
+// IsFilterableFormat reports whether features in the given format (a MIME type
+// such as an INFO_FORMAT or outputFormat value) can be filtered.
+func IsFilterableFormat(format string) bool {
+	format = strings.ToLower(format)
+	return strings.Contains(format, "json") || strings.Contains(format, "gml") || strings.Contains(format, "xml")
+}
+
+// Filter removes the properties that are not allowed by policy from a GeoJSON
+// or GML document, depending on its content type.
+func Filter(body []byte, contentType string, policy AttributePolicy, defaultLayer string) ([]byte, error) {
+	contentType = strings.ToLower(contentType)
+
+	switch {
+	case strings.Contains(contentType, "json"):
+		return FilterGeoJSON(body, policy, defaultLayer)
+	case strings.Contains(contentType, "gml") || strings.Contains(contentType, "xml"):
+		return FilterGML(body, policy, defaultLayer)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
@@ -0,0 +1,89 @@
+package feature
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// FilterGeoJSON removes the properties that are not allowed by policy from a
+// GeoJSON Feature or FeatureCollection. All features belong to defaultLayer
+// when it is set, which is the case when the request names a single layer.
+// Otherwise the layer of a feature is derived from its identifier (layer.fid).
+// Features of which the layer cannot be determined or has no entry in the
+// policy lose all of their properties.
+func FilterGeoJSON(body []byte, policy AttributePolicy, defaultLayer string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	layerOf := func(feature map[string]interface{}) string {
+		if defaultLayer != "" {
+			return defaultLayer
+		}
+
+		if id, ok := feature["id"].(string); ok {
+			if i := strings.LastIndex(id, "."); i > 0 {
+				return id[:i]
+			}
+		}
+
+		return ""
+	}
+
+	if err := filterDocument(document, policy, layerOf); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(document)
+}
+
+// FilterFeatures removes the properties that are not allowed by policy from a
+// decoded GeoJSON Feature or FeatureCollection, of which all features belong to
+// layer.
+func FilterFeatures(document map[string]interface{}, policy AttributePolicy, layer string) error {
+	return filterDocument(document, policy, func(map[string]interface{}) string {
+		return layer
+	})
+}
+
+func filterDocument(document map[string]interface{}, policy AttributePolicy, layerOf func(map[string]interface{}) string) error {
+	switch document["type"] {
+	case "FeatureCollection":
+		features, _ := document["features"].([]interface{})
+		for _, f := range features {
+			if feature, ok := f.(map[string]interface{}); ok {
+				filterFeatureProperties(feature, policy, layerOf(feature))
+			}
+		}
+	case "Feature":
+		filterFeatureProperties(document, policy, layerOf(document))
+	default:
+		return errors.New("document is not a GeoJSON feature or feature collection")
+	}
+
+	return nil
+}
+
+func filterFeatureProperties(feature map[string]interface{}, policy AttributePolicy, layer string) {
+	properties, ok := feature["properties"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if !policy.Covers(layer) {
+		feature["properties"] = map[string]interface{}{}
+		return
+	}
+
+	for name := range properties {
+		if !policy.Allows(layer, name) {
+			delete(properties, name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package feature
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFilterGeoJSON(t *testing.T) {
+	policy := AttributePolicy{
+		"ws:percelen": {"naam"},
+		"gebouwen":    {"*"},
+	}
+
+	tests := []struct {
+		name         string
+		defaultLayer string
+		body         string
+		want         []map[string]interface{}
+	}{
+		{
+			name:         "default layer overrides the identifier",
+			defaultLayer: "percelen",
+			body:         `{"type":"FeatureCollection","features":[{"type":"Feature","id":"gebouwen.1","properties":{"naam":"a","eigenaar":"b"}}]}`,
+			want:         []map[string]interface{}{{"naam": "a"}},
+		},
+		{
+			name: "layer from the identifier",
+			body: `{"type":"FeatureCollection","features":[{"type":"Feature","id":"percelen.1","properties":{"naam":"a","eigenaar":"b"}},{"type":"Feature","id":"gebouwen.2","properties":{"naam":"c","eigenaar":"d"}}]}`,
+			want: []map[string]interface{}{{"naam": "a"}, {"naam": "c", "eigenaar": "d"}},
+		},
+		{
+			name: "layer not in the policy",
+			body: `{"type":"FeatureCollection","features":[{"type":"Feature","id":"wegen.1","properties":{"naam":"a"}}]}`,
+			want: []map[string]interface{}{{}},
+		},
+		{
+			name: "identifier without a layer",
+			body: `{"type":"Feature","id":"1","properties":{"naam":"a"}}`,
+			want: []map[string]interface{}{{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filtered, err := FilterGeoJSON([]byte(test.body), policy, test.defaultLayer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var document map[string]interface{}
+			if err := json.Unmarshal(filtered, &document); err != nil {
+				t.Fatal(err)
+			}
+
+			features := []interface{}{document}
+			if document["type"] == "FeatureCollection" {
+				features = document["features"].([]interface{})
+			}
+
+			var got []map[string]interface{}
+			for _, f := range features {
+				got = append(got, f.(map[string]interface{})["properties"].(map[string]interface{}))
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got properties %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterGeoJSONRejectsOtherDocuments(t *testing.T) {
+	if _, err := FilterGeoJSON([]byte(`{"type":"Point","coordinates":[1,2]}`), AttributePolicy{}, ""); err == nil {
+		t.Error("expected an error for a geometry")
+	}
+}
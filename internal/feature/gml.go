@@ -0,0 +1,109 @@
+package feature
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// FilterGML removes the properties that are not allowed by policy from the
+// features in a GML feature collection. Features are the children of
+// featureMember, featureMembers or member elements, also when they are nested
+// in a WFS container such as a Tuple or an inner FeatureCollection or in a
+// property of another feature. The layer of a top-level feature is
+// defaultLayer when it is set and otherwise, like the layer of a nested
+// feature, the local name of the feature element. Features of a layer without
+// an entry in the policy lose all of their properties. The document is edited
+// in place, so namespace declarations and formatting of the remaining content
+// are preserved.
+func FilterGML(body []byte, policy AttributePolicy, defaultLayer string) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	type feature struct {
+		depth int
+		layer string
+	}
+
+	var (
+		stack    []xml.Name
+		features []feature
+		cuts     [][2]int64
+	)
+
+	for {
+		offset := decoder.InputOffset()
+
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth := len(stack)
+
+			if depth > 0 && isMemberElement(stack[depth-1]) && !isWFSNamespace(t.Name.Space) {
+				layer := t.Name.Local
+				if defaultLayer != "" && len(features) == 0 {
+					layer = defaultLayer
+				}
+
+				features = append(features, feature{depth: depth, layer: layer})
+			} else if n := len(features); n > 0 && depth == features[n-1].depth+1 && !isGMLNamespace(t.Name.Space) {
+				layer := features[n-1].layer
+				if !policy.Covers(layer) || !policy.Allows(layer, t.Name.Local) {
+					if err := decoder.Skip(); err != nil {
+						return nil, err
+					}
+
+					cuts = append(cuts, [2]int64{offset, decoder.InputOffset()})
+					continue
+				}
+			}
+
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			if n := len(features); n > 0 && len(stack) == features[n-1].depth {
+				features = features[:n-1]
+			}
+		}
+	}
+
+	if len(cuts) == 0 {
+		return body, nil
+	}
+
+	var filtered bytes.Buffer
+	var last int64
+	for _, cut := range cuts {
+		filtered.Write(body[last:cut[0]])
+		last = cut[1]
+	}
+	filtered.Write(body[last:])
+
+	return filtered.Bytes(), nil
+}
+
+// isMemberElement reports whether name is a GML or WFS element that contains
+// features. Elements of the application schema with the same local name are
+// properties of a feature.
+func isMemberElement(name xml.Name) bool {
+	if !isGMLNamespace(name.Space) && !isWFSNamespace(name.Space) {
+		return false
+	}
+
+	return name.Local == "featureMember" || name.Local == "featureMembers" || name.Local == "member"
+}
+
+func isGMLNamespace(space string) bool {
+	return strings.HasPrefix(space, "http://www.opengis.net/gml")
+}
+
+func isWFSNamespace(space string) bool {
+	return strings.HasPrefix(space, "http://www.opengis.net/wfs")
+}
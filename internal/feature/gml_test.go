@@ -0,0 +1,95 @@
+package feature
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterGML(t *testing.T) {
+	policy := AttributePolicy{
+		"percelen": {"naam"},
+		"gebouwen": {"*"},
+	}
+
+	tests := []struct {
+		name         string
+		defaultLayer string
+		body         string
+		contains     []string
+		excludes     []string
+	}{
+		{
+			name: "direct features",
+			body: `<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:gml="http://www.opengis.net/gml/3.2" xmlns:ws="urn:ws">` +
+				`<wfs:member><ws:percelen gml:id="p.1"><gml:boundedBy/><ws:naam>a</ws:naam><ws:eigenaar>b</ws:eigenaar></ws:percelen></wfs:member>` +
+				`<wfs:member><ws:gebouwen gml:id="g.1"><ws:naam>c</ws:naam><ws:eigenaar>d</ws:eigenaar></ws:gebouwen></wfs:member>` +
+				`</wfs:FeatureCollection>`,
+			contains: []string{"<gml:boundedBy/>", "<ws:naam>a</ws:naam>", "<ws:eigenaar>d</ws:eigenaar>"},
+			excludes: []string{"<ws:eigenaar>b</ws:eigenaar>"},
+		},
+		{
+			name:         "default layer overrides the element name",
+			defaultLayer: "ws:percelen",
+			body: `<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:ws="urn:ws">` +
+				`<wfs:member><ws:gebouwen><ws:naam>a</ws:naam><ws:eigenaar>b</ws:eigenaar></ws:gebouwen></wfs:member>` +
+				`</wfs:FeatureCollection>`,
+			contains: []string{"<ws:naam>a</ws:naam>"},
+			excludes: []string{"eigenaar"},
+		},
+		{
+			name: "layer not in the policy",
+			body: `<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:ws="urn:ws">` +
+				`<wfs:member><ws:wegen><ws:naam>a</ws:naam></ws:wegen></wfs:member>` +
+				`</wfs:FeatureCollection>`,
+			contains: []string{"<ws:wegen></ws:wegen>"},
+			excludes: []string{"naam"},
+		},
+		{
+			name: "features in a tuple and an inner collection",
+			body: `<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:ws="urn:ws">` +
+				`<wfs:member><wfs:Tuple><wfs:member><ws:percelen><ws:naam>a</ws:naam><ws:eigenaar>b</ws:eigenaar></ws:percelen></wfs:member></wfs:Tuple></wfs:member>` +
+				`<wfs:member><wfs:FeatureCollection><wfs:member><ws:percelen><ws:naam>c</ws:naam><ws:eigenaar>d</ws:eigenaar></ws:percelen></wfs:member></wfs:FeatureCollection></wfs:member>` +
+				`</wfs:FeatureCollection>`,
+			contains: []string{"<ws:naam>a</ws:naam>", "<ws:naam>c</ws:naam>"},
+			excludes: []string{"eigenaar"},
+		},
+		{
+			name:         "feature nested in a property",
+			defaultLayer: "gebouwen",
+			body: `<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:gml="http://www.opengis.net/gml/3.2" xmlns:ws="urn:ws">` +
+				`<wfs:member><ws:gebouwen><ws:perceel><gml:featureMember><ws:percelen><ws:naam>a</ws:naam><ws:eigenaar>b</ws:eigenaar></ws:percelen></gml:featureMember></ws:perceel></ws:gebouwen></wfs:member>` +
+				`</wfs:FeatureCollection>`,
+			contains: []string{"<ws:perceel>", "<ws:naam>a</ws:naam>"},
+			excludes: []string{"eigenaar"},
+		},
+		{
+			name: "property named member",
+			body: `<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:ws="urn:ws">` +
+				`<wfs:member><ws:percelen><ws:naam><ws:member><ws:eigenaar>b</ws:eigenaar></ws:member></ws:naam><ws:member>c</ws:member></ws:percelen></wfs:member>` +
+				`</wfs:FeatureCollection>`,
+			contains: []string{"<ws:eigenaar>b</ws:eigenaar>"},
+			excludes: []string{"<ws:member>c</ws:member>"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filtered, err := FilterGML([]byte(test.body), policy, test.defaultLayer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range test.contains {
+				if !strings.Contains(string(filtered), s) {
+					t.Errorf("%s does not contain %s", filtered, s)
+				}
+			}
+
+			for _, s := range test.excludes {
+				if strings.Contains(string(filtered), s) {
+					t.Errorf("%s contains %s", filtered, s)
+				}
+			}
+		})
+	}
+}
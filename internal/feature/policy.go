@@ -0,0 +1,105 @@
+package feature
+
+import "strings"
+
+// AttributePolicy maps layer names to the attributes that may be exposed for
+// features of that layer. Layers without an entry are not restricted.
+type AttributePolicy map[string][]string
+
+// MergePolicies combines policies, where entries of later policies take
+// precedence over entries for the same layer in earlier ones.
+func MergePolicies(policies ...AttributePolicy) AttributePolicy {
+	merged := AttributePolicy{}
+	for _, policy := range policies {
+		for layer, attributes := range policy {
+			merged[layer] = attributes
+		}
+	}
+
+	return merged
+}
+
+// Attributes returns the allowed attributes for layer. A layer matches an entry
+// on its full name or, when one of both is prefixed with a workspace, on its
+// local name.
+func (p AttributePolicy) Attributes(layer string) ([]string, bool) {
+	if attributes, ok := p[layer]; ok {
+		return attributes, true
+	}
+
+	local := LocalName(layer)
+	for name, attributes := range p {
+		if LocalName(name) == local {
+			return attributes, true
+		}
+	}
+
+	return nil, false
+}
+
+// Restricted returns the allowed attributes for layer and whether the layer is
+// restricted at all, which is not the case when it has no entry or when its
+// entry contains the wildcard "*".
+func (p AttributePolicy) Restricted(layer string) ([]string, bool) {
+	attributes, ok := p.Attributes(layer)
+	if !ok {
+		return nil, false
+	}
+
+	for _, attribute := range attributes {
+		if attribute == "*" {
+			return nil, false
+		}
+	}
+
+	return attributes, true
+}
+
+// Restricts reports whether any of the layers is restricted by the policy.
+func (p AttributePolicy) Restricts(layers ...string) bool {
+	for _, layer := range layers {
+		if _, ok := p.Restricted(layer); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Covers reports whether the policy has an entry for layer. Features in a
+// filtered response of which the layer is not covered expose no attributes at
+// all, since they can not be related to the layers that were authorized.
+func (p AttributePolicy) Covers(layer string) bool {
+	if layer == "" {
+		return false
+	}
+
+	_, ok := p.Attributes(layer)
+	return ok
+}
+
+// Allows reports whether attribute may be exposed for features of layer.
+func (p AttributePolicy) Allows(layer string, attribute string) bool {
+	attributes, ok := p.Restricted(layer)
+	if !ok {
+		return true
+	}
+
+	for _, allowed := range attributes {
+		if allowed == LocalName(attribute) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LocalName returns a layer or attribute name without the prefix of its
+// workspace or namespace.
+func LocalName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return name
+}
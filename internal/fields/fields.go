@@ -0,0 +1,204 @@
+package fields
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selection selects the fields of a JSON document by the paths to include and
+// the paths to exclude.
+//
+// Paths are dotted, such as _embedded.zakelijkGerechtigden[].persoon.type, in
+// which * matches any key. Arrays are traversed implicitly, a [] suffix only
+// documents that a field is an array. A JSONPath $. prefix and [*] suffixes
+// are accepted as well.
+type Selection struct {
+	include *node
+	exclude *node
+}
+
+// node is a node of a trie of paths.
+type node struct {
+	children map[string]*node
+	wildcard *node
+	leaf     bool
+}
+
+// Parse returns the selection of the include and exclude paths. Without
+// include paths all fields are included.
+func Parse(include []string, exclude []string) (*Selection, error) {
+	selection := &Selection{}
+
+	if len(include) > 0 {
+		selection.include = &node{}
+		for _, path := range include {
+			if err := selection.include.add(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(exclude) > 0 {
+		selection.exclude = &node{}
+		for _, path := range exclude {
+			if err := selection.exclude.add(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return selection, nil
+}
+
+func (n *node) add(path string) error {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.ReplaceAll(path, "[*]", "[]")
+
+	if path == "" {
+		return fmt.Errorf("empty field path")
+	}
+
+	current := n
+	for _, key := range strings.Split(path, ".") {
+		for strings.HasSuffix(key, "[]") {
+			key = strings.TrimSuffix(key, "[]")
+		}
+
+		if key == "" && current == n {
+			// A path such as [].name of a document that is an array.
+			continue
+		}
+
+		if key == "" || strings.ContainsAny(key, "[]") {
+			return fmt.Errorf("invalid field path %q", path)
+		}
+
+		current = current.child(key)
+	}
+
+	current.leaf = true
+	return nil
+}
+
+func (n *node) child(key string) *node {
+	if key == "*" {
+		if n.wildcard == nil {
+			n.wildcard = &node{}
+		}
+		return n.wildcard
+	}
+
+	if n.children == nil {
+		n.children = map[string]*node{}
+	}
+
+	child, ok := n.children[key]
+	if !ok {
+		child = &node{}
+		n.children[key] = child
+	}
+
+	return child
+}
+
+// matches returns the children of nodes that match key.
+func matches(nodes []*node, key string) []*node {
+	var matched []*node
+	for _, n := range nodes {
+		if child, ok := n.children[key]; ok {
+			matched = append(matched, child)
+		}
+		if n.wildcard != nil {
+			matched = append(matched, n.wildcard)
+		}
+	}
+
+	return matched
+}
+
+func anyLeaf(nodes []*node) bool {
+	for _, n := range nodes {
+		if n.leaf {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply returns a copy of a decoded JSON value with only the selected fields.
+// Fields that are not in the value are left out, rather than set to null.
+func (s *Selection) Apply(value interface{}) interface{} {
+	if s.include != nil {
+		var ok bool
+		if value, ok = include(value, []*node{s.include}); !ok {
+			return nil
+		}
+	}
+
+	if s.exclude != nil {
+		value = exclude(value, []*node{s.exclude})
+	}
+
+	return value
+}
+
+// include returns value with only the fields of the paths in nodes, and false
+// when none of them can be in the value.
+func include(value interface{}, nodes []*node) (interface{}, bool) {
+	if anyLeaf(nodes) {
+		return value, true
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		included := map[string]interface{}{}
+		for key, child := range v {
+			matched := matches(nodes, key)
+			if len(matched) == 0 {
+				continue
+			}
+
+			if child, ok := include(child, matched); ok {
+				included[key] = child
+			}
+		}
+		return included, true
+	case []interface{}:
+		included := []interface{}{}
+		for _, element := range v {
+			if element, ok := include(element, nodes); ok {
+				included = append(included, element)
+			}
+		}
+		return included, true
+	default:
+		return nil, false
+	}
+}
+
+// exclude returns value without the fields of the paths in nodes.
+func exclude(value interface{}, nodes []*node) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		remaining := map[string]interface{}{}
+		for key, child := range v {
+			matched := matches(nodes, key)
+			switch {
+			case len(matched) == 0:
+				remaining[key] = child
+			case !anyLeaf(matched):
+				remaining[key] = exclude(child, matched)
+			}
+		}
+		return remaining
+	case []interface{}:
+		remaining := make([]interface{}, len(v))
+		for i, element := range v {
+			remaining[i] = exclude(element, nodes)
+		}
+		return remaining
+	default:
+		return value
+	}
+}
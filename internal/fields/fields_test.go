@@ -0,0 +1,110 @@
+package fields
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const document = `{
+	"_links": {"self": {"href": "/zaken/1"}},
+	"_embedded": {
+		"zakelijkGerechtigden": [
+			{"type": "eigendom", "persoon": {"type": "natuurlijk", "bsn": "999993653", "naam": "Jan"}},
+			{"type": "erfpacht", "persoon": {"type": "niet-natuurlijk", "kvk": "12345678"}}
+		]
+	},
+	"identificatie": "1",
+	"eigenaar": "Jan"
+}`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    string
+	}{
+		{
+			"include",
+			[]string{"identificatie", "_embedded.zakelijkGerechtigden[].type"},
+			nil,
+			`{"identificatie": "1", "_embedded": {"zakelijkGerechtigden": [{"type": "eigendom"}, {"type": "erfpacht"}]}}`,
+		},
+		{
+			"include with wildcard and jsonpath",
+			[]string{"$._embedded.zakelijkGerechtigden[*].persoon.type", "_links.*.href"},
+			nil,
+			`{"_links": {"self": {"href": "/zaken/1"}}, "_embedded": {"zakelijkGerechtigden": [{"persoon": {"type": "natuurlijk"}}, {"persoon": {"type": "niet-natuurlijk"}}]}}`,
+		},
+		{
+			"exclude",
+			nil,
+			[]string{"eigenaar", "_embedded.zakelijkGerechtigden.persoon.bsn", "_links"},
+			`{"identificatie": "1", "_embedded": {"zakelijkGerechtigden": [{"type": "eigendom", "persoon": {"type": "natuurlijk", "naam": "Jan"}}, {"type": "erfpacht", "persoon": {"type": "niet-natuurlijk", "kvk": "12345678"}}]}}`,
+		},
+		{
+			"include and exclude",
+			[]string{"_embedded.zakelijkGerechtigden[].persoon"},
+			[]string{"_embedded.zakelijkGerechtigden[].persoon.*"},
+			`{"_embedded": {"zakelijkGerechtigden": [{"persoon": {}}, {"persoon": {}}]}}`,
+		},
+		{
+			"include below a scalar",
+			[]string{"identificatie.waarde", "eigenaar"},
+			nil,
+			`{"eigenaar": "Jan"}`,
+		},
+		{
+			"include of a missing field",
+			[]string{"onbekend"},
+			nil,
+			`{}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selection, err := Parse(test.include, test.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var value, want interface{}
+			json.Unmarshal([]byte(document), &value)
+			json.Unmarshal([]byte(test.want), &want)
+
+			if got := selection.Apply(value); !reflect.DeepEqual(got, want) {
+				encoded, _ := json.Marshal(got)
+				t.Errorf("Apply() = %s, want %s", encoded, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyToArray(t *testing.T) {
+	selection, err := Parse([]string{"[].naam"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value interface{}
+	json.Unmarshal([]byte(`[{"naam": "a", "bsn": "1"}, "geheim", {"bsn": "2"}]`), &value)
+
+	want := []interface{}{map[string]interface{}{"naam": "a"}, map[string]interface{}{}}
+	if got := selection.Apply(value); !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+
+	if got := selection.Apply("geheim"); got != nil {
+		t.Errorf("Apply() of a scalar = %v, want nil", got)
+	}
+}
+
+func TestParseInvalidPath(t *testing.T) {
+	for _, path := range []string{"", "$.", "a..b", "a.[0]", "a[0].b"} {
+		if _, err := Parse([]string{path}, nil); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid path", path)
+		}
+	}
+}
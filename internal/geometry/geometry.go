@@ -0,0 +1,199 @@
+package geometry
+
+import (
+	"regexp"
+	"strings"
+)
+
+type Point struct {
+	X, Y float64
+}
+
+// Polygon is a list of rings, the first of which is the exterior ring and the
+// others are holes.
+type Polygon [][]Point
+
+// MultiPolygon is an area consisting of one or more polygons.
+type MultiPolygon []Polygon
+
+// Contains reports whether every path lies within the area. A path is a
+// sequence of connected vertices, a single vertex represents a point. A closed
+// path is a ring of which the enclosed area must not contain a hole of the
+// area either.
+func (m MultiPolygon) Contains(paths [][]Point) bool {
+	for _, path := range paths {
+		if !m.containsPath(path) || (isClosed(path) && m.holeWithin(path)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// holeWithin reports whether a hole of the area lies inside ring. The holes do
+// not cross the ring when its vertices and edges are inside the area, so it is
+// enough to check one of their vertices.
+func (m MultiPolygon) holeWithin(ring []Point) bool {
+	for _, polygon := range m {
+		for _, hole := range polygon[1:] {
+			for _, point := range hole {
+				if !onRing(ring, point) {
+					if ringContains(ring, point) {
+						return true
+					}
+					break
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func isClosed(path []Point) bool {
+	return len(path) >= 4 && path[0] == path[len(path)-1]
+}
+
+func (m MultiPolygon) containsPath(path []Point) bool {
+	for i, point := range path {
+		polygon, ok := m.polygonContaining(point)
+		if !ok {
+			return false
+		}
+
+		if i > 0 && polygon.crosses(path[i-1], point) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m MultiPolygon) polygonContaining(point Point) (Polygon, bool) {
+	for _, polygon := range m {
+		if polygon.contains(point) {
+			return polygon, true
+		}
+	}
+
+	return nil, false
+}
+
+func (p Polygon) contains(point Point) bool {
+	if len(p) == 0 || !ringContains(p[0], point) {
+		return false
+	}
+
+	for _, hole := range p[1:] {
+		if ringContains(hole, point) && !onRing(hole, point) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// crosses reports whether the segment from a to b properly crosses one of the
+// rings of the polygon, in which case it leaves the polygon even when both
+// of its ends are inside.
+func (p Polygon) crosses(a Point, b Point) bool {
+	for _, ring := range p {
+		for i := 1; i < len(ring); i++ {
+			if segmentsCross(a, b, ring[i-1], ring[i]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ringContains reports whether point lies inside or on the boundary of ring,
+// using the even-odd rule.
+func ringContains(ring []Point, point Point) bool {
+	if onRing(ring, point) {
+		return true
+	}
+
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Y > point.Y) != (b.Y > point.Y) && point.X < (b.X-a.X)*(point.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+func onRing(ring []Point, point Point) bool {
+	for i := 1; i < len(ring); i++ {
+		a, b := ring[i-1], ring[i]
+		if orientation(a, b, point) == 0 &&
+			point.X >= min(a.X, b.X) && point.X <= max(a.X, b.X) &&
+			point.Y >= min(a.Y, b.Y) && point.Y <= max(a.Y, b.Y) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func segmentsCross(a, b, c, d Point) bool {
+	o1, o2 := orientation(a, b, c), orientation(a, b, d)
+	o3, o4 := orientation(c, d, a), orientation(c, d, b)
+
+	return o1*o2 < 0 && o3*o4 < 0
+}
+
+func orientation(a, b, c Point) int {
+	value := (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+	switch {
+	case value > 0:
+		return 1
+	case value < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+var epsgCode = regexp.MustCompile(`(?i)EPSG(?::+|/0/|\.xml#|/)(\d+)$`)
+
+// NormalizeCRS returns the EPSG:<code> form of the common ways to refer to an
+// EPSG coordinate reference system, such as urn:ogc:def:crs:EPSG::28992 and
+// http://www.opengis.net/def/crs/EPSG/0/28992. Use SwapsAxes to find out
+// whether the axis order of these forms differs.
+func NormalizeCRS(crs string) string {
+	if match := epsgCode.FindStringSubmatch(strings.TrimSpace(crs)); match != nil {
+		return "EPSG:" + match[1]
+	}
+
+	return strings.TrimSpace(crs)
+}
+
+// latitudeFirst are the EPSG codes of common geographic coordinate reference
+// systems of which EPSG defines the axis order as latitude, longitude.
+var latitudeFirst = map[string]bool{
+	"4258": true, // ETRS89
+	"4267": true, // NAD27
+	"4269": true, // NAD83
+	"4289": true, // Amersfoort
+	"4326": true, // WGS 84
+	"4937": true, // ETRS89 3D
+	"4979": true, // WGS 84 3D
+}
+
+// SwapsAxes reports whether coordinates in crs are in latitude, longitude
+// order. This is the case for the URN and OGC URI forms of geographic EPSG
+// systems, which follow the axis order of EPSG, while the EPSG:<code> form and
+// the epsg.xml URL use longitude, latitude.
+func SwapsAxes(crs string) bool {
+	crs = strings.ToLower(strings.TrimSpace(crs))
+	if !strings.HasPrefix(crs, "urn:") && !strings.Contains(crs, "/def/crs/") {
+		return false
+	}
+
+	match := epsgCode.FindStringSubmatch(crs)
+	return match != nil && latitudeFirst[match[1]]
+}
@@ -0,0 +1,76 @@
+package geometry
+
+import "testing"
+
+func TestContains(t *testing.T) {
+	square := Polygon{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}
+	withHole := Polygon{square[0], {{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}}}
+	concave := Polygon{{{0, 0}, {10, 0}, {10, 10}, {6, 10}, {6, 4}, {4, 4}, {4, 10}, {0, 10}, {0, 0}}}
+
+	tests := []struct {
+		name  string
+		area  MultiPolygon
+		paths [][]Point
+		want  bool
+	}{
+		{"point inside", MultiPolygon{square}, [][]Point{{{5, 5}}}, true},
+		{"point on the boundary", MultiPolygon{square}, [][]Point{{{0, 5}}}, true},
+		{"point outside", MultiPolygon{square}, [][]Point{{{11, 5}}}, false},
+		{"point in a hole", MultiPolygon{withHole}, [][]Point{{{5, 5}}}, false},
+		{"line crossing a hole", MultiPolygon{withHole}, [][]Point{{{1, 5}, {9, 5}}}, false},
+		{"line leaving a concave area", MultiPolygon{concave}, [][]Point{{{2, 8}, {8, 8}}}, false},
+		{"ring around a hole", MultiPolygon{withHole}, [][]Point{{{1, 1}, {9, 1}, {9, 9}, {1, 9}, {1, 1}}}, false},
+		{"ring beside a hole", MultiPolygon{withHole}, [][]Point{{{1, 1}, {3, 1}, {3, 3}, {1, 3}, {1, 1}}}, true},
+		{"point in a second polygon", MultiPolygon{square, {{{20, 20}, {30, 20}, {30, 30}, {20, 20}}}}, [][]Point{{{25, 21}}}, true},
+	}
+
+	for _, test := range tests {
+		if got := test.area.Contains(test.paths); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestContainsFullExtent(t *testing.T) {
+	area := MultiPolygon{{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}}
+
+	tests := []struct {
+		name string
+		gml  string
+		want bool
+	}{
+		{"circle inside", `<gml:CircleByCenterPoint numArc="1"><gml:pos>5 5</gml:pos><gml:radius>4</gml:radius></gml:CircleByCenterPoint>`, true},
+		{"circle extending outside", `<gml:CircleByCenterPoint numArc="1"><gml:pos>5 5</gml:pos><gml:radius>6</gml:radius></gml:CircleByCenterPoint>`, false},
+		{"arc bulging outside", `<gml:Arc><gml:posList>1 9 5 9.5 9 9</gml:posList></gml:Arc>`, false},
+		{"envelope inside", `<gml:Envelope><gml:lowerCorner>1 1</gml:lowerCorner><gml:upperCorner>9 9</gml:upperCorner></gml:Envelope>`, true},
+	}
+
+	for _, test := range tests {
+		gml, err := ParseGML([]byte(test.gml))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := area.Contains(gml.Paths); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	concave := MultiPolygon{{{{0, 0}, {10, 0}, {10, 10}, {6, 10}, {6, 4}, {4, 4}, {4, 10}, {0, 10}, {0, 0}}}}
+	gml, err := ParseGML([]byte(`<gml:Envelope><gml:lowerCorner>1 5</gml:lowerCorner><gml:upperCorner>9 9</gml:upperCorner></gml:Envelope>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if concave.Contains(gml.Paths) {
+		t.Error("an envelope of which only the corners are inside a concave area is contained")
+	}
+}
+
+func TestNormalizeCRS(t *testing.T) {
+	for _, crs := range []string{"EPSG:28992", "urn:ogc:def:crs:EPSG::28992", "http://www.opengis.net/def/crs/EPSG/0/28992", "http://www.opengis.net/gml/srs/epsg.xml#28992"} {
+		if got := NormalizeCRS(crs); got != "EPSG:28992" {
+			t.Errorf("NormalizeCRS(%q) = %q", crs, got)
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package geometry
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseWKT parses a POLYGON or MULTIPOLYGON in Well-Known Text, optionally
+// prefixed with an EWKT SRID.
+func ParseWKT(wkt string) (MultiPolygon, error) {
+	wkt = strings.TrimSpace(wkt)
+	if i := strings.Index(wkt, ";"); i >= 0 && strings.HasPrefix(strings.ToUpper(wkt), "SRID=") {
+		wkt = strings.TrimSpace(wkt[i+1:])
+	}
+
+	open := strings.Index(wkt, "(")
+	if open < 0 {
+		return nil, errors.New("invalid WKT")
+	}
+
+	kind := strings.ToUpper(strings.TrimSpace(wkt[:open]))
+	body := strings.TrimSpace(wkt[open:])
+
+	coordinates, rest, err := parseWKTList(body)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, errors.New("invalid WKT: unexpected trailing text")
+	}
+
+	switch kind {
+	case "POLYGON":
+		polygon, err := toPolygon(coordinates)
+		return MultiPolygon{polygon}, err
+	case "MULTIPOLYGON":
+		return toMultiPolygon(coordinates)
+	default:
+		return nil, fmt.Errorf("unsupported WKT geometry type: %s", kind)
+	}
+}
+
+// WKTCRS returns the coordinate reference system of the SRID prefix of an
+// EWKT, or an empty string when it has none.
+func WKTCRS(wkt string) string {
+	wkt = strings.TrimSpace(wkt)
+	i := strings.Index(wkt, ";")
+	if i < 0 || !strings.HasPrefix(strings.ToUpper(wkt), "SRID=") {
+		return ""
+	}
+
+	return "EPSG:" + strings.TrimSpace(wkt[len("SRID="):i])
+}
+
+// parseWKTList parses a parenthesized WKT coordinate list into nested slices
+// of the same shape as GeoJSON coordinates, so that both formats share the
+// conversion to polygons.
+func parseWKTList(text string) ([]interface{}, string, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "(") {
+		return nil, "", errors.New("invalid WKT: expected (")
+	}
+	text = strings.TrimSpace(text[1:])
+
+	var list []interface{}
+	for {
+		if strings.HasPrefix(text, "(") {
+			nested, rest, err := parseWKTList(text)
+			if err != nil {
+				return nil, "", err
+			}
+
+			list = append(list, nested)
+			text = strings.TrimSpace(rest)
+		} else {
+			end := strings.IndexAny(text, ",)")
+			if end < 0 {
+				return nil, "", errors.New("invalid WKT: expected )")
+			}
+
+			var position []interface{}
+			for _, field := range strings.Fields(text[:end]) {
+				value, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid WKT: %w", err)
+				}
+
+				position = append(position, value)
+			}
+
+			list = append(list, position)
+			text = text[end:]
+		}
+
+		switch {
+		case strings.HasPrefix(text, ","):
+			text = strings.TrimSpace(text[1:])
+		case strings.HasPrefix(text, ")"):
+			return list, text[1:], nil
+		default:
+			return nil, "", errors.New("invalid WKT: expected , or )")
+		}
+	}
+}
+
+// ParseGeoJSON parses a GeoJSON Polygon or MultiPolygon, which may be wrapped
+// in a Feature.
+func ParseGeoJSON(data []byte) (MultiPolygon, error) {
+	var object struct {
+		Type        string          `json:"type"`
+		Coordinates interface{}     `json:"coordinates"`
+		Geometry    json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	switch object.Type {
+	case "Feature":
+		return ParseGeoJSON(object.Geometry)
+	case "Polygon":
+		polygon, err := toPolygon(object.Coordinates)
+		return MultiPolygon{polygon}, err
+	case "MultiPolygon":
+		return toMultiPolygon(object.Coordinates)
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON geometry type: %s", object.Type)
+	}
+}
+
+func toMultiPolygon(value interface{}) (MultiPolygon, error) {
+	polygons, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("invalid multipolygon coordinates")
+	}
+
+	var multiPolygon MultiPolygon
+	for _, p := range polygons {
+		polygon, err := toPolygon(p)
+		if err != nil {
+			return nil, err
+		}
+
+		multiPolygon = append(multiPolygon, polygon)
+	}
+
+	return multiPolygon, nil
+}
+
+func toPolygon(value interface{}) (Polygon, error) {
+	rings, ok := value.([]interface{})
+	if !ok || len(rings) == 0 {
+		return nil, errors.New("invalid polygon coordinates")
+	}
+
+	var polygon Polygon
+	for _, r := range rings {
+		positions, ok := r.([]interface{})
+		if !ok || len(positions) < 4 {
+			return nil, errors.New("invalid polygon ring")
+		}
+
+		var ring []Point
+		for _, p := range positions {
+			position, ok := p.([]interface{})
+			if !ok || len(position) < 2 {
+				return nil, errors.New("invalid position")
+			}
+
+			x, xOk := position[0].(float64)
+			y, yOk := position[1].(float64)
+			if !xOk || !yOk {
+				return nil, errors.New("invalid position")
+			}
+
+			ring = append(ring, Point{x, y})
+		}
+
+		polygon = append(polygon, ring)
+	}
+
+	return polygon, nil
+}
+
+// GML is the geometry found in a fragment of GML: its coordinate reference
+// system and the paths formed by its coordinates. The coordinates of paths are
+// in longitude, latitude order for geographic systems, whatever the axis order
+// of the srsName they were given in.
+type GML struct {
+	CRS   string
+	Paths [][]Point
+}
+
+// gmlElement is an element of a GML fragment that is being parsed, with the
+// coordinate reference system and dimension that apply to its content.
+type gmlElement struct {
+	name      string
+	srs       string
+	dimension int
+	// start is the index of the first path found in the element.
+	start int
+	// radius is the radius of a CircleByCenterPoint or ArcByCenterPoint.
+	radius    float64
+	hasRadius bool
+}
+
+// ParseGML collects the coordinates of all geometries in a GML fragment, such
+// as the content of a feature property. Every pos, posList, coordinates and
+// corner element forms a path, except for consecutive pos or coord elements,
+// which form a single path. Envelopes and boxes form the ring of their four
+// corners, and circles and arcs a polygon enclosing their full circle, so that
+// their whole extent is checked. It returns nil when the fragment contains no
+// elements, such as the text of a non-geometry property. Elements of which the
+// coordinates can not be read, like text in unsupported elements, references
+// to geometries elsewhere or geometries without coordinates, are an error, so
+// that they are never mistaken for a value without a geometry.
+func ParseGML(fragment []byte) (*GML, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(fragment))
+	decoder.Strict = false
+
+	var (
+		geometry   = &GML{}
+		found      bool
+		elements   bool
+		stack      []gmlElement
+		lastWasPos bool
+	)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			if len(stack) > 0 && len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("unsupported content in %s", stack[len(stack)-1].name)
+			}
+		case xml.StartElement:
+			elements = true
+			if attr(t, "href") != "" {
+				return nil, fmt.Errorf("reference in %s is not supported", t.Name.Local)
+			}
+
+			parent := gmlElement{dimension: 2}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+
+			srs := attr(t, "srsName")
+			if srs == "" {
+				srs = parent.srs
+			}
+
+			dimension := parent.dimension
+			if value := attr(t, "srsDimension"); value != "" {
+				d, err := strconv.Atoi(value)
+				if err != nil || d < 2 {
+					return nil, fmt.Errorf("invalid srsDimension %q", value)
+				}
+				dimension = d
+			}
+
+			var text string
+			var coord gmlCoord
+			switch t.Name.Local {
+			case "pos", "posList", "coordinates", "lowerCorner", "upperCorner", "radius":
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return nil, err
+				}
+			case "coord":
+				if err := decoder.DecodeElement(&coord, &t); err != nil {
+					return nil, err
+				}
+			default:
+				stack = append(stack, gmlElement{name: t.Name.Local, srs: srs, dimension: dimension, start: len(geometry.Paths)})
+				lastWasPos = false
+				continue
+			}
+
+			if t.Name.Local == "radius" {
+				if len(stack) == 0 {
+					return nil, errors.New("radius outside of a circle")
+				}
+
+				radius, err := parseRadius(text, attr(t, "uom"))
+				if err != nil {
+					return nil, err
+				}
+
+				stack[len(stack)-1].radius, stack[len(stack)-1].hasRadius = radius, true
+				lastWasPos = false
+				continue
+			}
+
+			var points []Point
+			switch t.Name.Local {
+			case "coordinates":
+				points, err = parseCoordinates(text, attr(t, "cs"), attr(t, "ts"))
+			case "coord":
+				points, err = coord.points()
+			default:
+				points, err = parsePositions(text, dimension)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if SwapsAxes(srs) {
+				for i := range points {
+					points[i] = Point{points[i].Y, points[i].X}
+				}
+			}
+
+			if !found {
+				geometry.CRS = srs
+			} else if srs != "" && geometry.CRS != "" && NormalizeCRS(srs) != NormalizeCRS(geometry.CRS) {
+				return nil, errors.New("geometry uses more than one coordinate reference system")
+			} else if geometry.CRS == "" {
+				geometry.CRS = srs
+			}
+			found = true
+
+			position := t.Name.Local == "pos" || t.Name.Local == "coord"
+			if position && lastWasPos {
+				last := len(geometry.Paths) - 1
+				geometry.Paths[last] = append(geometry.Paths[last], points...)
+			} else {
+				geometry.Paths = append(geometry.Paths, points)
+			}
+
+			lastWasPos = position
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+
+			element := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			lastWasPos = false
+
+			if err := geometry.closeElement(element); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !elements {
+		return nil, nil
+	}
+	if !found {
+		return nil, errors.New("geometry without coordinates")
+	}
+
+	return geometry, nil
+}
+
+// gmlCoord is a GML 2 coord element, which holds the coordinates of a
+// position in X, Y and optional Z elements.
+type gmlCoord struct {
+	X *string `xml:"X"`
+	Y *string `xml:"Y"`
+	Z *string `xml:"Z"`
+}
+
+func (c gmlCoord) points() ([]Point, error) {
+	if c.X == nil || c.Y == nil {
+		return nil, errors.New("invalid coord")
+	}
+
+	x, err := strconv.ParseFloat(strings.TrimSpace(*c.X), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := strconv.ParseFloat(strings.TrimSpace(*c.Y), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Z != nil {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(*c.Z), 64); err != nil {
+			return nil, err
+		}
+	}
+
+	return []Point{{x, y}}, nil
+}
+
+// closeElement replaces the paths of an envelope, box, circle or arc by the
+// area it covers.
+func (g *GML) closeElement(element gmlElement) error {
+	var points []Point
+	for _, path := range g.Paths[element.start:] {
+		points = append(points, path...)
+	}
+
+	switch element.name {
+	case "Envelope", "Box":
+		if len(points) != 2 {
+			return fmt.Errorf("invalid %s", element.name)
+		}
+
+		lower, upper := points[0], points[1]
+		g.Paths = append(g.Paths[:element.start], []Point{
+			lower, {upper.X, lower.Y}, upper, {lower.X, upper.Y}, lower,
+		})
+	case "CircleByCenterPoint", "ArcByCenterPoint":
+		if len(points) != 1 || !element.hasRadius {
+			return fmt.Errorf("invalid %s", element.name)
+		}
+
+		g.Paths = append(g.Paths[:element.start], circle(points[0], element.radius))
+	case "Circle", "Arc", "ArcString":
+		if len(points) < 3 || len(points)%2 == 0 {
+			return fmt.Errorf("invalid %s", element.name)
+		}
+
+		// An arc passes through its points but bulges beyond them, so the
+		// full circle of every arc is checked besides the points themselves.
+		for i := 0; i+2 < len(points); i += 2 {
+			if center, radius, ok := circleThrough(points[i], points[i+1], points[i+2]); ok {
+				g.Paths = append(g.Paths, circle(center, radius))
+			}
+		}
+	}
+
+	return nil
+}
+
+// circleSegments is the number of segments of the polygon that approximates a
+// circle.
+const circleSegments = 36
+
+// circle returns a closed ring of which the enclosed area contains the circle
+// with center and radius.
+func circle(center Point, radius float64) []Point {
+	// The vertices lie outside of the circle, so that the edges do not cut
+	// through it.
+	outer := radius / math.Cos(math.Pi/circleSegments)
+
+	ring := make([]Point, 0, circleSegments+1)
+	for i := 0; i < circleSegments; i++ {
+		angle := 2 * math.Pi * float64(i) / circleSegments
+		ring = append(ring, Point{center.X + outer*math.Cos(angle), center.Y + outer*math.Sin(angle)})
+	}
+
+	return append(ring, ring[0])
+}
+
+// circleThrough returns the circle through three points, which do not form a
+// circle when they are on a line.
+func circleThrough(a, b, c Point) (Point, float64, bool) {
+	d := 2 * (a.X*(b.Y-c.Y) + b.X*(c.Y-a.Y) + c.X*(a.Y-b.Y))
+	if d == 0 {
+		return Point{}, 0, false
+	}
+
+	a2, b2, c2 := a.X*a.X+a.Y*a.Y, b.X*b.X+b.Y*b.Y, c.X*c.X+c.Y*c.Y
+	center := Point{
+		(a2*(b.Y-c.Y) + b2*(c.Y-a.Y) + c2*(a.Y-b.Y)) / d,
+		(a2*(c.X-b.X) + b2*(a.X-c.X) + c2*(b.X-a.X)) / d,
+	}
+
+	return center, math.Hypot(a.X-center.X, a.Y-center.Y), true
+}
+
+// parseRadius parses the radius of a circle, which has to be in the unit of
+// the coordinate reference system. Only metres are accepted as explicit unit,
+// which results in too large a circle when the system is in degrees.
+func parseRadius(text string, uom string) (float64, error) {
+	switch strings.ToLower(uom) {
+	case "", "m", "metre", "meter", "urn:ogc:def:uom:epsg::9001", "http://www.opengis.net/def/uom/epsg/0/9001":
+	default:
+		return 0, fmt.Errorf("unsupported radius unit %q", uom)
+	}
+
+	radius, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || radius < 0 || math.IsInf(radius, 0) || math.IsNaN(radius) {
+		return 0, fmt.Errorf("invalid radius %q", text)
+	}
+
+	return radius, nil
+}
+
+func parsePositions(text string, dimension int) ([]Point, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields)%dimension != 0 {
+		return nil, errors.New("invalid number of coordinates")
+	}
+
+	var points []Point
+	for i := 0; i < len(fields); i += dimension {
+		x, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, Point{x, y})
+	}
+
+	return points, nil
+}
+
+func parseCoordinates(text string, cs string, ts string) ([]Point, error) {
+	if cs == "" {
+		cs = ","
+	}
+
+	var tuples []string
+	if ts == "" || strings.TrimSpace(ts) == "" {
+		tuples = strings.Fields(text)
+	} else {
+		tuples = strings.Split(strings.TrimSpace(text), ts)
+	}
+
+	var points []Point
+	for _, tuple := range tuples {
+		values := strings.Split(strings.TrimSpace(tuple), cs)
+		if len(values) < 2 {
+			return nil, errors.New("invalid coordinate tuple")
+		}
+
+		x, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := strconv.ParseFloat(strings.TrimSpace(values[1]), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, Point{x, y})
+	}
+
+	return points, nil
+}
+
+func attr(element xml.StartElement, local string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+
+	return ""
+}
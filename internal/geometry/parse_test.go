@@ -0,0 +1,256 @@
+package geometry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWKT(t *testing.T) {
+	tests := []struct {
+		wkt      string
+		polygons int
+		err      bool
+	}{
+		{wkt: "POLYGON((0 0, 10 0, 10 10, 0 10, 0 0))", polygons: 1},
+		{wkt: "SRID=28992;POLYGON((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 4 2, 4 4, 2 2))", polygons: 1},
+		{wkt: "MULTIPOLYGON(((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))", polygons: 2},
+		{wkt: "POLYGON((0 0, 10 0, 10 10, 0 0)) trailing", err: true},
+		{wkt: "POLYGON((0 0, 10 0, 0 0))", err: true},
+		{wkt: "LINESTRING(0 0, 1 1)", err: true},
+		{wkt: "POLYGON((0 0, 10 0, 10 10, 0 0)", err: true},
+	}
+
+	for _, test := range tests {
+		polygons, err := ParseWKT(test.wkt)
+		switch {
+		case test.err && err == nil:
+			t.Errorf("%s: expected an error", test.wkt)
+		case !test.err && err != nil:
+			t.Errorf("%s: %v", test.wkt, err)
+		case !test.err && len(polygons) != test.polygons:
+			t.Errorf("%s: got %d polygons, want %d", test.wkt, len(polygons), test.polygons)
+		}
+	}
+}
+
+func TestWKTCRS(t *testing.T) {
+	tests := map[string]string{
+		"SRID=28992;POLYGON((0 0, 10 0, 10 10, 0 0))": "EPSG:28992",
+		"srid=4326; POLYGON((0 0, 10 0, 10 10, 0 0))": "EPSG:4326",
+		"POLYGON((0 0, 10 0, 10 10, 0 0))":            "",
+	}
+
+	for wkt, want := range tests {
+		if got := WKTCRS(wkt); got != want {
+			t.Errorf("WKTCRS(%q) = %q, want %q", wkt, got, want)
+		}
+	}
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	polygons, err := ParseGeoJSON([]byte(`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,0]]]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (MultiPolygon{{{{0, 0}, {10, 0}, {10, 10}, {0, 0}}}}); !reflect.DeepEqual(polygons, want) {
+		t.Errorf("got %v, want %v", polygons, want)
+	}
+
+	if _, err := ParseGeoJSON([]byte(`{"type":"Point","coordinates":[0,0]}`)); err == nil {
+		t.Error("expected an error for a point")
+	}
+}
+
+func TestParseGML(t *testing.T) {
+	tests := []struct {
+		name  string
+		gml   string
+		crs   string
+		paths [][]Point
+		err   string
+	}{
+		{
+			name:  "pos list with dimension 3",
+			gml:   `<gml:LineString srsName="EPSG:28992" srsDimension="3"><gml:posList>1 2 0 3 4 0</gml:posList></gml:LineString>`,
+			crs:   "EPSG:28992",
+			paths: [][]Point{{{1, 2}, {3, 4}}},
+		},
+		{
+			name:  "consecutive pos elements",
+			gml:   `<gml:LineString><gml:pos>1 2</gml:pos><gml:pos>3 4</gml:pos></gml:LineString>`,
+			paths: [][]Point{{{1, 2}, {3, 4}}},
+		},
+		{
+			name:  "gml 2 coordinates",
+			gml:   `<gml:Point srsName="EPSG:28992"><gml:coordinates>1,2</gml:coordinates></gml:Point>`,
+			crs:   "EPSG:28992",
+			paths: [][]Point{{{1, 2}}},
+		},
+		{
+			name:  "gml 2 coord",
+			gml:   `<gml:Point srsName="EPSG:28992"><gml:coord><gml:X>1</gml:X><gml:Y>2</gml:Y></gml:coord></gml:Point>`,
+			crs:   "EPSG:28992",
+			paths: [][]Point{{{1, 2}}},
+		},
+		{
+			name:  "consecutive coord elements with z",
+			gml:   `<gml:LineString><gml:coord><gml:X>1</gml:X><gml:Y>2</gml:Y><gml:Z>0</gml:Z></gml:coord><gml:coord><gml:X>3</gml:X><gml:Y>4</gml:Y><gml:Z>0</gml:Z></gml:coord></gml:LineString>`,
+			paths: [][]Point{{{1, 2}, {3, 4}}},
+		},
+		{
+			name: "coord without y",
+			gml:  `<gml:Point><gml:coord><gml:X>1</gml:X></gml:coord></gml:Point>`,
+			err:  "invalid coord",
+		},
+		{
+			name: "srsDimension 1",
+			gml:  `<gml:LineString srsDimension="1"><gml:posList>1 2 3</gml:posList></gml:LineString>`,
+			err:  "invalid srsDimension",
+		},
+		{
+			name: "srsDimension 0",
+			gml:  `<gml:Point srsDimension="0"><gml:pos>1 2</gml:pos></gml:Point>`,
+			err:  "invalid srsDimension",
+		},
+		{
+			name: "odd number of coordinates",
+			gml:  `<gml:LineString><gml:posList>1 2 3</gml:posList></gml:LineString>`,
+			err:  "invalid number of coordinates",
+		},
+		{
+			name:  "urn axis order",
+			gml:   `<gml:Point srsName="urn:ogc:def:crs:EPSG::4326"><gml:pos>52 5</gml:pos></gml:Point>`,
+			crs:   "urn:ogc:def:crs:EPSG::4326",
+			paths: [][]Point{{{5, 52}}},
+		},
+		{
+			name:  "legacy axis order",
+			gml:   `<gml:Point srsName="EPSG:4326"><gml:pos>5 52</gml:pos></gml:Point>`,
+			crs:   "EPSG:4326",
+			paths: [][]Point{{{5, 52}}},
+		},
+		{
+			name:  "projected urn keeps its axis order",
+			gml:   `<gml:Point srsName="urn:ogc:def:crs:EPSG::28992"><gml:pos>1 2</gml:pos></gml:Point>`,
+			crs:   "urn:ogc:def:crs:EPSG::28992",
+			paths: [][]Point{{{1, 2}}},
+		},
+		{
+			name:  "envelope",
+			gml:   `<gml:Envelope><gml:lowerCorner>0 0</gml:lowerCorner><gml:upperCorner>2 1</gml:upperCorner></gml:Envelope>`,
+			paths: [][]Point{{{0, 0}, {2, 0}, {2, 1}, {0, 1}, {0, 0}}},
+		},
+		{
+			name:  "gml 2 box",
+			gml:   `<gml:Box><gml:coordinates>0,0 2,1</gml:coordinates></gml:Box>`,
+			paths: [][]Point{{{0, 0}, {2, 0}, {2, 1}, {0, 1}, {0, 0}}},
+		},
+		{
+			name: "envelope without upper corner",
+			gml:  `<gml:Envelope><gml:lowerCorner>0 0</gml:lowerCorner></gml:Envelope>`,
+			err:  "invalid Envelope",
+		},
+		{
+			name: "circle without radius",
+			gml:  `<gml:CircleByCenterPoint numArc="1"><gml:pos>0 0</gml:pos></gml:CircleByCenterPoint>`,
+			err:  "invalid CircleByCenterPoint",
+		},
+		{
+			name: "radius in kilometres",
+			gml:  `<gml:CircleByCenterPoint numArc="1"><gml:pos>0 0</gml:pos><gml:radius uom="km">1</gml:radius></gml:CircleByCenterPoint>`,
+			err:  "unsupported radius unit",
+		},
+		{
+			name: "more than one crs",
+			gml:  `<gml:MultiPoint><gml:Point srsName="EPSG:28992"><gml:pos>1 2</gml:pos></gml:Point><gml:Point srsName="EPSG:4326"><gml:pos>1 2</gml:pos></gml:Point></gml:MultiPoint>`,
+			err:  "more than one coordinate reference system",
+		},
+		{
+			name: "text value",
+			gml:  `a`,
+		},
+		{
+			name: "element without coordinates",
+			gml:  `<naam>a</naam>`,
+			err:  "unsupported content in naam",
+		},
+		{
+			name: "geometry without coordinates",
+			gml:  `<gml:Point srsName="EPSG:28992"/>`,
+			err:  "geometry without coordinates",
+		},
+		{
+			name: "unsupported coordinate element",
+			gml:  `<gml:Point><gml:vector>1 2</gml:vector></gml:Point>`,
+			err:  "unsupported content in vector",
+		},
+		{
+			name: "reference to a geometry",
+			gml:  `<gml:pointProperty xlink:href="#p1"/>`,
+			err:  "reference in pointProperty is not supported",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gml, err := ParseGML([]byte(test.gml))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.paths == nil {
+				if gml != nil {
+					t.Fatalf("got %v, want no geometry", gml)
+				}
+				return
+			}
+
+			if gml.CRS != test.crs || !reflect.DeepEqual(gml.Paths, test.paths) {
+				t.Errorf("got %s %v, want %s %v", gml.CRS, gml.Paths, test.crs, test.paths)
+			}
+		})
+	}
+}
+
+func TestParseGMLCircle(t *testing.T) {
+	gml, err := ParseGML([]byte(`<gml:CircleByCenterPoint numArc="1"><gml:pos>10 10</gml:pos><gml:radius uom="m">5</gml:radius></gml:CircleByCenterPoint>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gml.Paths) != 1 || !isClosed(gml.Paths[0]) {
+		t.Fatalf("got %v, want a single ring", gml.Paths)
+	}
+
+	for _, point := range gml.Paths[0] {
+		if point.X < 4.9 || point.X > 15.1 || point.Y < 4.9 || point.Y > 15.1 {
+			t.Fatalf("vertex %v is too far from the circle", point)
+		}
+	}
+}
+
+func TestSwapsAxes(t *testing.T) {
+	tests := map[string]bool{
+		"EPSG:4326":                                    false,
+		"urn:ogc:def:crs:EPSG::4326":                   true,
+		"urn:x-ogc:def:crs:EPSG:4258":                  true,
+		"http://www.opengis.net/def/crs/EPSG/0/4326":   true,
+		"http://www.opengis.net/gml/srs/epsg.xml#4326": false,
+		"urn:ogc:def:crs:EPSG::28992":                  false,
+		"":                                             false,
+	}
+
+	for crs, want := range tests {
+		if got := SwapsAxes(crs); got != want {
+			t.Errorf("SwapsAxes(%q) = %v, want %v", crs, got, want)
+		}
+	}
+}
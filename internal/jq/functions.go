@@ -0,0 +1,271 @@
+package jq
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// dateLayouts are the layouts of the dates accepted by age_from.
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "20060102"}
+
+// functions returns the functions that rewrite programs can use besides the
+// jq builtins. They are meant for data minimisation:
+//
+//   - mask(n) replaces all but the last n characters of a string with
+//     asterisks, or all characters when the string has no more than n.
+//   - hash replaces a value by the hex encoded HMAC-SHA256 of it with hashKey,
+//     so that it can still be used to link records. It is only defined when a
+//     key is given, so that programs using it without a key fail to compile.
+//   - age_from(date) returns the age in whole years of someone born on date.
+//   - round_coord(n) rounds a number, or the numbers of a (nested) array of
+//     coordinates, to n decimals.
+//   - redact_paths(paths) removes paths from a value. A path is an array, as in
+//     delpaths, or a dotted string in which * matches any key and [] any
+//     element of an array.
+func functions(hashKey []byte) []gojq.CompilerOption {
+	options := []gojq.CompilerOption{
+		gojq.WithFunction("mask", 1, 1, mask),
+		gojq.WithFunction("age_from", 1, 1, func(_ interface{}, args []interface{}) interface{} {
+			return ageFrom(args[0], time.Now())
+		}),
+		gojq.WithFunction("round_coord", 1, 1, roundCoord),
+		gojq.WithFunction("redact_paths", 1, 1, redactPaths),
+	}
+
+	if len(hashKey) > 0 {
+		options = append(options, gojq.WithFunction("hash", 0, 0, func(value interface{}, _ []interface{}) interface{} {
+			return hash(hashKey, value)
+		}))
+	}
+
+	return options
+}
+
+func mask(value interface{}, args []interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	keep, ok := toInt(args[0])
+	if !ok || keep < 0 {
+		return fmt.Errorf("mask: %v is not a valid number of characters", args[0])
+	}
+
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case int, *big.Int:
+		text = fmt.Sprint(v)
+	case float64:
+		// Numbers decoded from JSON are floats, of which fmt would format
+		// large ones such as a BSN in exponent notation.
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("mask: cannot mask %s", gojq.TypeOf(value))
+	}
+
+	characters := []rune(text)
+	if len(characters) <= keep {
+		keep = 0
+	}
+
+	masked := strings.Repeat("*", len(characters)-keep)
+	return masked + string(characters[len(characters)-keep:])
+}
+
+func hash(key []byte, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	data, ok := value.(string)
+	if !ok {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("hash: %w", err)
+		}
+		data = string(encoded)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ageFrom returns the age at now of someone born on date, which is a string or
+// a Haal Centraal date object with a datum field. Dates of which only the year
+// or month is known result in null.
+func ageFrom(date interface{}, now time.Time) interface{} {
+	switch v := date.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		if datum, ok := v["datum"]; ok {
+			return ageFrom(datum, now)
+		}
+		return nil
+	case string:
+		for _, layout := range dateLayouts {
+			born, err := time.Parse(layout, v)
+			if err != nil {
+				continue
+			}
+
+			age := now.Year() - born.Year()
+			if now.Month() < born.Month() || (now.Month() == born.Month() && now.Day() < born.Day()) {
+				age--
+			}
+			return age
+		}
+		return fmt.Errorf("age_from: %q is not a date", v)
+	default:
+		return fmt.Errorf("age_from: cannot compute the age from %s", gojq.TypeOf(date))
+	}
+}
+
+func roundCoord(value interface{}, args []interface{}) interface{} {
+	decimals, ok := toInt(args[0])
+	if !ok || decimals < 0 {
+		return fmt.Errorf("round_coord: %v is not a valid number of decimals", args[0])
+	}
+
+	return round(value, math.Pow(10, float64(decimals)))
+}
+
+func round(value interface{}, factor float64) interface{} {
+	switch v := value.(type) {
+	case nil, int, *big.Int:
+		return v
+	case float64:
+		return math.Round(v*factor) / factor
+	case []interface{}:
+		rounded := make([]interface{}, len(v))
+		for i, element := range v {
+			rounded[i] = round(element, factor)
+			if err, ok := rounded[i].(error); ok {
+				return err
+			}
+		}
+		return rounded
+	default:
+		return fmt.Errorf("round_coord: cannot round %s", gojq.TypeOf(value))
+	}
+}
+
+func redactPaths(value interface{}, args []interface{}) interface{} {
+	paths, ok := args[0].([]interface{})
+	if !ok {
+		return fmt.Errorf("redact_paths: %s is not an array of paths", gojq.TypeOf(args[0]))
+	}
+
+	for _, path := range paths {
+		var segments []interface{}
+		switch p := path.(type) {
+		case []interface{}:
+			segments = p
+		case string:
+			segments = parseDottedPath(p)
+		default:
+			return fmt.Errorf("redact_paths: %s is not a path", gojq.TypeOf(path))
+		}
+
+		value = redactPath(value, segments)
+	}
+
+	return value
+}
+
+// parseDottedPath splits a path such as a.b[].c into the segments a, b, [] and
+// c. Numeric segments are array indices.
+func parseDottedPath(path string) []interface{} {
+	var segments []interface{}
+	for _, part := range strings.Split(path, ".") {
+		iterate := strings.HasSuffix(part, "[]")
+		part = strings.TrimSuffix(part, "[]")
+
+		if part != "" {
+			if index, err := strconv.Atoi(part); err == nil {
+				segments = append(segments, index)
+			} else {
+				segments = append(segments, part)
+			}
+		}
+
+		if iterate {
+			segments = append(segments, "[]")
+		}
+	}
+
+	return segments
+}
+
+// redactPath returns a copy of value without the values at path. Missing
+// paths are ignored.
+func redactPath(value interface{}, path []interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	segment, rest := path[0], path[1:]
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		key, ok := segment.(string)
+		if !ok {
+			return v
+		}
+
+		redacted := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			switch {
+			case key != "*" && key != k:
+				redacted[k] = child
+			case len(rest) > 0:
+				redacted[k] = redactPath(child, rest)
+			}
+		}
+		return redacted
+	case []interface{}:
+		index, isIndex := toInt(segment)
+		if isIndex && index < 0 {
+			index += len(v)
+		}
+
+		redacted := make([]interface{}, 0, len(v))
+		for i, child := range v {
+			switch {
+			case !(segment == "[]" || segment == "*" || (isIndex && i == index)):
+				redacted = append(redacted, child)
+			case len(rest) > 0:
+				redacted = append(redacted, redactPath(child, rest))
+			}
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,104 @@
+package jq
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFunctions(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("sleutel"))
+	mac.Write([]byte("999993653"))
+	hashed := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name    string
+		program string
+		input   interface{}
+		want    interface{}
+		err     string
+	}{
+		{"mask", `mask(4)`, "999993653", "*****3653", ""},
+		{"mask short value", `mask(4)`, "123", "***", ""},
+		{"mask number", `mask(2)`, 12345, "***45", ""},
+		{"mask numeric bsn", `mask(4)`, float64(123456789), "*****6789", ""},
+		{"mask numeric phone number", `mask(2)`, float64(31201234567), "*********67", ""},
+		{"mask fraction", `mask(2)`, 0.5, "*.5", ""},
+		{"mask null", `mask(2)`, nil, nil, ""},
+		{"mask negative", `mask(-1)`, "123", nil, "not a valid number"},
+		{"mask object", `mask(1)`, map[string]interface{}{}, nil, "cannot mask object"},
+		{"hash", `hash`, "999993653", hashed, ""},
+		{"hash null", `hash`, nil, nil, ""},
+		{"age from date", `age_from("2000-06-15")`, nil, time.Now().Year() - 2000 - birthdayAhead(6, 15), ""},
+		{"age from unknown day", `age_from({"datum": "2000-00-00"})`, nil, nil, "not a date"},
+		{"age from object without date", `age_from({"jaar": 2000})`, nil, nil, ""},
+		{"round coordinates", `round_coord(2)`, []interface{}{5.123456, []interface{}{52.987654}}, []interface{}{5.12, []interface{}{52.99}}, ""},
+		{"round string", `round_coord(2)`, "5.1", nil, "cannot round string"},
+		{
+			"redact paths",
+			`redact_paths(["burgerservicenummer", "adressen[].huisnummer", ["naam", "voornamen"]])`,
+			map[string]interface{}{
+				"burgerservicenummer": "999993653",
+				"naam":                map[string]interface{}{"voornamen": "Jan", "geslachtsnaam": "Jansen"},
+				"adressen":            []interface{}{map[string]interface{}{"straat": "Dorpsstraat", "huisnummer": 1}},
+			},
+			map[string]interface{}{
+				"naam":     map[string]interface{}{"geslachtsnaam": "Jansen"},
+				"adressen": []interface{}{map[string]interface{}{"straat": "Dorpsstraat"}},
+			},
+			"",
+		},
+		{"redact wildcard", `redact_paths(["*.geheim"])`, map[string]interface{}{"a": map[string]interface{}{"geheim": 1, "open": 2}}, map[string]interface{}{"a": map[string]interface{}{"open": 2}}, ""},
+		{"redact invalid path", `redact_paths([1])`, map[string]interface{}{}, nil, "is not a path"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := Compile(test.program, []byte("sleutel"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Run(context.Background(), code, test.input, Context{}, OutputFirst)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Run() error = %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Run() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHashWithoutKey(t *testing.T) {
+	if _, err := Compile(`.bsn | hash`, nil); err == nil {
+		t.Error("Compile() accepted hash without a key")
+	}
+
+	if _, err := NewCache(0, nil).Get(`hash`); err == nil {
+		t.Error("Cache.Get() accepted hash without a key")
+	}
+}
+
+// birthdayAhead returns 1 when the birthday on month and day is still ahead
+// this year.
+func birthdayAhead(month time.Month, day int) int {
+	now := time.Now()
+	if now.Month() < month || (now.Month() == month && now.Day() < day) {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,252 @@
+package jq
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/itchyny/gojq"
+)
+
+// DefaultCacheSize is the number of compiled programs kept by a cache when no
+// size is configured.
+const DefaultCacheSize = 256
+
+// Variables are the variables that describe the request to a program, in the
+// order in which Context.Values returns their values.
+var Variables = []string{"$user", "$claims", "$groups", "$path", "$query", "$headers", "$env"}
+
+// Compile parses and compiles a jq program with the request variables and the
+// functions of the proxy. The hash function uses hashKey as its key.
+func Compile(source string, hashKey []byte) (*gojq.Code, error) {
+	query, err := gojq.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	options := append(functions(hashKey), gojq.WithVariables(Variables))
+	return gojq.Compile(query, options...)
+}
+
+// Output modes of a program: the first output only, or all outputs collected
+// into an array.
+const (
+	OutputFirst   = "first"
+	OutputCollect = "collect"
+)
+
+// Run runs a program for a request and returns its output according to the
+// output mode. A program without output results in null, or in an empty array
+// when the outputs are collected. A halt stops the program without error.
+func Run(ctx context.Context, code *gojq.Code, input interface{}, request Context, mode string) (interface{}, error) {
+	iter := code.RunWithContext(ctx, input, request.Values()...)
+
+	outputs := []interface{}{}
+	for {
+		value, ok := iter.Next()
+		if !ok {
+			break
+		}
+
+		if err, ok := value.(error); ok {
+			var halt *gojq.HaltError
+			if errors.As(err, &halt) && halt.Value() == nil {
+				break
+			}
+
+			return nil, err
+		}
+
+		if mode != OutputCollect {
+			return value, nil
+		}
+
+		outputs = append(outputs, value)
+	}
+
+	if mode != OutputCollect {
+		return nil, nil
+	}
+
+	return outputs, nil
+}
+
+// ValidOutput returns an error for an unknown output mode. An empty mode is
+// the first output mode.
+func ValidOutput(mode string) error {
+	switch mode {
+	case "", OutputFirst, OutputCollect:
+		return nil
+	default:
+		return fmt.Errorf("unknown output mode %q, expected %s or %s", mode, OutputFirst, OutputCollect)
+	}
+}
+
+// Context is the request a program runs for.
+type Context struct {
+	// User is the username returned by the authorization service, which is
+	// empty before the request is authorized.
+	User string
+	// Claims are the claims of the verified bearer token of the request.
+	Claims map[string]interface{}
+	// Path holds the route variables of the request.
+	Path    map[string]string
+	Query   url.Values
+	Headers http.Header
+	// Env holds the environment variables that programs may read, see
+	// Environment.
+	Env map[string]string
+}
+
+// credentialHeaders are the headers that are not passed to programs, so that
+// the credentials of a client can not end up in a rewritten request or
+// response.
+var credentialHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-api-key":           true,
+}
+
+// Environment returns the environment variables that are exposed to programs
+// as $env: the variables listed in names, and the variables starting with the
+// prefix of a name that ends in "*". Other variables, which may hold secrets,
+// are not exposed.
+func Environment(names []string) map[string]string {
+	env := map[string]string{}
+	for _, variable := range os.Environ() {
+		name, value, ok := strings.Cut(variable, "=")
+		if !ok {
+			continue
+		}
+
+		for _, allowed := range names {
+			prefix, isPrefix := strings.CutSuffix(allowed, "*")
+			if name == allowed || (isPrefix && strings.HasPrefix(name, prefix)) {
+				env[name] = value
+				break
+			}
+		}
+	}
+
+	return env
+}
+
+// Values returns the values of the request variables. Query parameters and
+// headers with more than one value are given as their first value and as all
+// values joined by a comma respectively, header names are lower case.
+// Credential headers are left out.
+func (c Context) Values() []interface{} {
+	claims := map[string]interface{}{}
+	for name, value := range c.Claims {
+		claims[name] = value
+	}
+
+	groups := []interface{}{}
+	switch value := claims["groups"].(type) {
+	case []interface{}:
+		groups = value
+	case string:
+		groups = append(groups, value)
+	}
+
+	path := map[string]interface{}{}
+	for name, value := range c.Path {
+		path[name] = value
+	}
+
+	query := map[string]interface{}{}
+	for name, values := range c.Query {
+		if len(values) > 0 {
+			query[name] = values[0]
+		}
+	}
+
+	headers := map[string]interface{}{}
+	for name, values := range c.Headers {
+		name = strings.ToLower(name)
+		if !credentialHeaders[name] {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+
+	env := map[string]interface{}{}
+	for name, value := range c.Env {
+		env[name] = value
+	}
+
+	var user interface{}
+	if c.User != "" {
+		user = c.User
+	}
+
+	return []interface{}{user, claims, groups, path, query, headers, env}
+}
+
+// Cache is a least recently used cache of compiled jq programs, for programs
+// that are only known at runtime. Programs that fail to compile are cached as
+// well, together with their error.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	hashKey []byte
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	source string
+	code   *gojq.Code
+	err    error
+}
+
+// NewCache returns a cache holding at most size programs, or DefaultCacheSize
+// programs when size is not positive. Programs are compiled with hashKey.
+func NewCache(size int, hashKey []byte) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	return &Cache{
+		size:    size,
+		hashKey: hashKey,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the compiled program for source, compiling it when it is not in
+// the cache.
+func (c *Cache) Get(source string) (*gojq.Code, error) {
+	c.mu.Lock()
+	if element, ok := c.entries[source]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*cacheEntry)
+		c.mu.Unlock()
+		return entry.code, entry.err
+	}
+	c.mu.Unlock()
+
+	code, err := Compile(source, c.hashKey)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[source]; !ok {
+		c.entries[source] = c.order.PushFront(&cacheEntry{source: source, code: code, err: err})
+
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).source)
+		}
+	}
+
+	return code, err
+}
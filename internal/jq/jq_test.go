@@ -0,0 +1,96 @@
+package jq
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("FILTER_PROXY_JQ_REGION", "noord")
+	t.Setenv("MUNICIPALITY_CODE", "0363")
+	t.Setenv("DATABASE_PASSWORD", "secret")
+
+	env := Environment([]string{"MUNICIPALITY_CODE", "FILTER_PROXY_JQ_*"})
+
+	want := map[string]string{"FILTER_PROXY_JQ_REGION": "noord", "MUNICIPALITY_CODE": "0363"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("Environment() = %v, want %v", env, want)
+	}
+
+	if env := Environment(nil); len(env) != 0 {
+		t.Errorf("Environment(nil) = %v, want no variables", env)
+	}
+}
+
+func TestContextValues(t *testing.T) {
+	request := Context{
+		Headers: http.Header{
+			"Accept":              {"application/json"},
+			"X-Forwarded-For":     {"10.0.0.1", "10.0.0.2"},
+			"Authorization":       {"Bearer token"},
+			"Proxy-Authorization": {"Basic dXNlcjpwYXNz"},
+			"Cookie":              {"session=secret"},
+			"X-Api-Key":           {"secret"},
+		},
+		Env: map[string]string{"MUNICIPALITY_CODE": "0363"},
+	}
+
+	values := request.Values()
+
+	headers := values[5].(map[string]interface{})
+	wantHeaders := map[string]interface{}{"accept": "application/json", "x-forwarded-for": "10.0.0.1, 10.0.0.2"}
+	if !reflect.DeepEqual(headers, wantHeaders) {
+		t.Errorf("$headers = %v, want %v", headers, wantHeaders)
+	}
+
+	env := values[6].(map[string]interface{})
+	if !reflect.DeepEqual(env, map[string]interface{}{"MUNICIPALITY_CODE": "0363"}) {
+		t.Errorf("$env = %v, want only the configured variables", env)
+	}
+
+	if values[0] != nil {
+		t.Errorf("$user = %v, want null before authorization", values[0])
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		mode    string
+		want    interface{}
+	}{
+		{"first output", ".[]", OutputFirst, 1.0},
+		{"collected outputs", ".[]", OutputCollect, []interface{}{1.0, 2.0}},
+		{"no output", "empty", OutputFirst, nil},
+		{"no collected output", "empty", OutputCollect, []interface{}{}},
+		{"halt", "halt", OutputFirst, nil},
+		{"environment", "$env.MUNICIPALITY_CODE", OutputFirst, "0363"},
+		{"credential header", "$headers.authorization", OutputFirst, nil},
+	}
+
+	request := Context{
+		Headers: http.Header{"Authorization": {"Bearer token"}},
+		Env:     map[string]string{"MUNICIPALITY_CODE": "0363"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := Compile(test.program, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Run(context.Background(), code, []interface{}{1.0, 2.0}, request, test.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Run() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
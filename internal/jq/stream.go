@@ -0,0 +1,357 @@
+package jq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// ParseArrayPath parses the path of an array in a JSON document, such as
+// ._embedded.zakelijkGerechtigden[] or .[] for a document that is an array.
+func ParseArrayPath(path string) ([]string, error) {
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(path, "."), "[]")
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	keys := strings.Split(trimmed, ".")
+	for _, key := range keys {
+		if key == "" || strings.ContainsAny(key, "[]") {
+			return nil, fmt.Errorf("invalid array path %q", path)
+		}
+	}
+
+	return keys, nil
+}
+
+// Stream is a JSON document of which the elements of one array are rewritten
+// one by one, so that the document never has to be held in memory as a whole.
+// Members of the objects around the array are dropped, unless an envelope
+// program keeps them.
+type Stream struct {
+	decoder  *json.Decoder
+	path     []string
+	envelope *gojq.Code
+	maxSize  int64
+	found    bool
+
+	// before holds the members that precede the key of the path in every
+	// object that has been entered, size their total size and opened the
+	// number of objects of which the closing brace has not been read yet.
+	before [][]member
+	size   int64
+	opened int
+}
+
+// member is a member of an object around the array of a stream.
+type member struct {
+	key   string
+	value json.RawMessage
+}
+
+// NewStream reads a document from r up to the start of the array at path. A
+// document without the array results in a document with an empty array. The
+// members around the array are passed to envelope as entries with a key and a
+// value, like with_entries, and the entries it outputs are written; they are
+// dropped when envelope is nil. No value in the document, nor the members
+// before the array together, may exceed maxSize bytes when it is positive.
+func NewStream(r io.Reader, path []string, envelope *gojq.Code, maxSize int64) (*Stream, error) {
+	stream := &Stream{path: path, envelope: envelope, maxSize: maxSize}
+	stream.decoder = json.NewDecoder(&windowReader{r: r, max: maxSize, offset: func() int64 {
+		return stream.decoder.InputOffset()
+	}})
+
+	for _, key := range path {
+		found, err := stream.enter(key)
+		if err != nil || !found {
+			return stream, err
+		}
+	}
+
+	token, err := stream.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token == nil {
+		return stream, nil
+	}
+
+	if token != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array at .%s", strings.Join(path, "."))
+	}
+
+	stream.found = true
+	return stream, nil
+}
+
+// windowReader reads the input of a decoder, and fails when the decoder holds
+// more than max bytes that it has not decoded yet, which happens when a single
+// value is larger than that. offset returns the position of the decoder.
+type windowReader struct {
+	r      io.Reader
+	read   int64
+	max    int64
+	offset func() int64
+}
+
+func (w *windowReader) Read(p []byte) (int, error) {
+	if w.max > 0 {
+		buffered := w.read - w.offset()
+		if buffered > w.max {
+			return 0, fmt.Errorf("a value in the response exceeds the maximum size of %d bytes", w.max)
+		}
+
+		if int64(len(p)) > w.max+1-buffered {
+			p = p[:w.max+1-buffered]
+		}
+	}
+
+	n, err := w.r.Read(p)
+	w.read += int64(n)
+	return n, err
+}
+
+// enter reads up to the value of key in the object that starts at the next
+// token, keeping the members before it when there is an envelope program.
+func (s *Stream) enter(key string) (bool, error) {
+	s.before = append(s.before, nil)
+
+	token, err := s.decoder.Token()
+	if err != nil {
+		return false, err
+	}
+
+	if token == nil {
+		return false, nil
+	}
+
+	if token != json.Delim('{') {
+		return false, fmt.Errorf("expected an object before %s", key)
+	}
+	s.opened++
+
+	for s.decoder.More() {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return false, err
+		}
+
+		if token == key {
+			return true, nil
+		}
+
+		m, err := s.member(token)
+		if err != nil {
+			return false, err
+		}
+
+		if s.envelope == nil {
+			continue
+		}
+
+		s.size += int64(len(m.value))
+		if s.maxSize > 0 && s.size > s.maxSize {
+			return false, fmt.Errorf("the members before the array exceed the maximum size of %d bytes", s.maxSize)
+		}
+
+		level := len(s.before) - 1
+		s.before[level] = append(s.before[level], m)
+	}
+
+	return false, nil
+}
+
+// member reads the value of the member with the key token.
+func (s *Stream) member(token json.Token) (member, error) {
+	key, ok := token.(string)
+	if !ok {
+		return member{}, fmt.Errorf("expected a key, found %v", token)
+	}
+
+	var value json.RawMessage
+	if err := s.decoder.Decode(&value); err != nil {
+		return member{}, err
+	}
+
+	return member{key: key, value: value}, nil
+}
+
+// rewriteMember returns the encoded members that the envelope program outputs
+// for m, each preceded by a comma.
+func (s *Stream) rewriteMember(ctx context.Context, m member, values []interface{}) ([]byte, error) {
+	if s.envelope == nil {
+		return nil, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(m.value, &value); err != nil {
+		return nil, err
+	}
+
+	var encoded []byte
+	err := run(ctx, s.envelope, map[string]interface{}{"key": m.key, "value": value}, values, func(output interface{}) error {
+		entry, ok := output.(map[string]interface{})
+		key, isString := entry["key"].(string)
+		if !ok || !isString {
+			return fmt.Errorf("the envelope program returned %v instead of an entry with a key and a value", output)
+		}
+
+		encodedKey, _ := json.Marshal(key)
+		encodedValue, err := json.Marshal(entry["value"])
+		if err != nil {
+			return err
+		}
+
+		encoded = append(encoded, ',')
+		encoded = append(encoded, encodedKey...)
+		encoded = append(encoded, ':')
+		encoded = append(encoded, encodedValue...)
+		return nil
+	})
+
+	return encoded, err
+}
+
+// run passes the outputs of code for input to emit. A halt without a value
+// ends the outputs early.
+func run(ctx context.Context, code *gojq.Code, input interface{}, values []interface{}, emit func(interface{}) error) error {
+	iter := code.RunWithContext(ctx, input, values...)
+	for {
+		output, ok := iter.Next()
+		if !ok {
+			return nil
+		}
+
+		if err, ok := output.(error); ok {
+			var halt *gojq.HaltError
+			if errors.As(err, &halt) && halt.Value() == nil {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := emit(output); err != nil {
+			return err
+		}
+	}
+}
+
+// Rewrite writes the document to w, in which every element of the array is
+// replaced by the outputs of code for it, and the members outside the array
+// by the outputs of the envelope program.
+func (s *Stream) Rewrite(ctx context.Context, code *gojq.Code, request Context, w io.Writer) error {
+	values := request.Values()
+
+	var prefix bytes.Buffer
+	for i, key := range s.path {
+		prefix.WriteString("{")
+		if i < len(s.before) {
+			for _, m := range s.before[i] {
+				encoded, err := s.rewriteMember(ctx, m, values)
+				if err != nil {
+					return err
+				}
+
+				// The comma of the first member moves to its end.
+				if len(encoded) > 0 {
+					prefix.Write(encoded[1:])
+					prefix.WriteString(",")
+				}
+			}
+		}
+
+		encoded, _ := json.Marshal(key)
+		fmt.Fprintf(&prefix, "%s:", encoded)
+	}
+	s.before = nil
+
+	if _, err := io.WriteString(w, prefix.String()+"["); err != nil {
+		return err
+	}
+
+	first := true
+	for s.found && s.decoder.More() {
+		var element interface{}
+		if err := s.decoder.Decode(&element); err != nil {
+			return err
+		}
+
+		err := run(ctx, code, element, values, func(output interface{}) error {
+			encoded, err := json.Marshal(output)
+			if err != nil {
+				return err
+			}
+
+			if !first {
+				encoded = append([]byte{','}, encoded...)
+			}
+			first = false
+
+			_, err = w.Write(encoded)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.found {
+		if _, err := s.decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return err
+	}
+
+	for level := len(s.path) - 1; level >= 0; level-- {
+		if err := s.close(ctx, level, values, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close writes the members that follow the key of the path in the object at
+// level, and the end of the object.
+func (s *Stream) close(ctx context.Context, level int, values []interface{}, w io.Writer) error {
+	if level < s.opened {
+		for s.decoder.More() {
+			token, err := s.decoder.Token()
+			if err != nil {
+				return err
+			}
+
+			m, err := s.member(token)
+			if err != nil {
+				return err
+			}
+
+			encoded, err := s.rewriteMember(ctx, m, values)
+			if err != nil {
+				return err
+			}
+
+			if _, err := w.Write(encoded); err != nil {
+				return err
+			}
+		}
+
+		if _, err := s.decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "}")
+	return err
+}
@@ -0,0 +1,238 @@
+package jq
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestParseArrayPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+		err  bool
+	}{
+		{".[]", nil, false},
+		{"._embedded.zakelijkGerechtigden[]", []string{"_embedded", "zakelijkGerechtigden"}, false},
+		{".features", []string{"features"}, false},
+		{".a..b[]", nil, true},
+		{".a[].b[]", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseArrayPath(test.path)
+		if (err != nil) != test.err {
+			t.Errorf("ParseArrayPath(%q) error = %v, want error %t", test.path, err, test.err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseArrayPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestStreamRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		document string
+		want     string
+		err      bool
+	}{
+		{
+			"top-level array",
+			".[]",
+			`[{"a": 1, "b": 2}, {"a": 3, "b": 4}]`,
+			`[{"a":1},{"a":3}]`,
+			false,
+		},
+		{
+			"embedded array with links and paging",
+			"._embedded.items[]",
+			`{"_links": {"self": {"href": "/items?page=1"}}, "_embedded": {"count": 2, "items": [{"a": 1, "b": 2}, {"a": 3}], "next": null}, "page": 1}`,
+			`{"_embedded":{"items":[{"a":1},{"a":3}]}}`,
+			false,
+		},
+		{
+			"missing array",
+			"._embedded.items[]",
+			`{"_links": {}, "_embedded": {"count": 0}, "page": 1}`,
+			`{"_embedded":{"items":[]}}`,
+			false,
+		},
+		{
+			"null object",
+			"._embedded.items[]",
+			`{"_embedded": null, "page": 1}`,
+			`{"_embedded":{"items":[]}}`,
+			false,
+		},
+		{
+			"null array",
+			".items[]",
+			`{"items": null, "page": 1}`,
+			`{"items":[]}`,
+			false,
+		},
+		{
+			"not an array",
+			".items[]",
+			`{"items": {"a": 1}}`,
+			"",
+			true,
+		},
+		{
+			"not an object",
+			"._embedded.items[]",
+			`{"_embedded": [1]}`,
+			"",
+			true,
+		},
+	}
+
+	code, err := Compile("{a}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, err := ParseArrayPath(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var output strings.Builder
+			stream, err := NewStream(strings.NewReader(test.document), path, nil, 0)
+			if err == nil {
+				err = stream.Rewrite(context.Background(), code, Context{}, &output)
+			}
+
+			if test.err {
+				if err == nil {
+					t.Errorf("Rewrite() = %s, want an error", output.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if output.String() != test.want {
+				t.Errorf("Rewrite() = %s, want %s", output.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestStreamRewriteError(t *testing.T) {
+	code, err := Compile(`error("stop")`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := NewStream(strings.NewReader(`[1, 2]`), nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	if err := stream.Rewrite(context.Background(), code, Context{}, &output); err == nil {
+		t.Errorf("Rewrite() = %s, want the error of the program", output.String())
+	}
+}
+
+func TestStreamRewriteEnvelope(t *testing.T) {
+	code, err := Compile("{a}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := Compile(`select(.key != "secret") | if .key == "_links" then .value |= {self} else . end`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := `{"secret": 1, "_links": {"self": {"href": "/items"}, "owner": {"href": "/owner"}}, "_embedded": {"secret": 2, "items": [{"a": 1, "b": 2}], "count": 1}, "page": 1}`
+	want := `{"_links":{"self":{"href":"/items"}},"_embedded":{"items":[{"a":1}],"count":1},"page":1}`
+
+	stream, err := NewStream(strings.NewReader(document), []string{"_embedded", "items"}, envelope, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	if err := stream.Rewrite(context.Background(), code, Context{}, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != want {
+		t.Errorf("Rewrite() = %s, want %s", output.String(), want)
+	}
+
+	invalid, err := Compile(".value", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err = NewStream(strings.NewReader(`{"page": 1, "items": []}`), []string{"items"}, invalid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output.Reset()
+	if err := stream.Rewrite(context.Background(), code, Context{}, &output); err == nil {
+		t.Errorf("Rewrite() = %s, want an error for an output that is not an entry", output.String())
+	}
+}
+
+func TestStreamMaxSize(t *testing.T) {
+	code, err := Compile(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := Compile(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := `"` + strings.Repeat("x", 100) + `"`
+
+	tests := []struct {
+		name     string
+		document string
+		envelope bool
+		err      bool
+	}{
+		{"small elements", `{"items": [` + strings.Repeat(`"xx",`, 100) + `"xx"]}`, false, false},
+		{"large element", `{"items": ["xx", ` + large + `]}`, false, true},
+		{"large member before the array", `{"links": ` + large + `, "items": []}`, false, true},
+		{"large member after the array", `{"items": [], "links": ` + large + `}`, false, true},
+		{"members before the array together", `{"a": "` + strings.Repeat("x", 30) + `", "b": "` + strings.Repeat("x", 30) + `", "items": []}`, true, true},
+		{"dropped members before the array together", `{"a": "` + strings.Repeat("x", 30) + `", "b": "` + strings.Repeat("x", 30) + `", "items": []}`, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var program *gojq.Code
+			if test.envelope {
+				program = envelope
+			}
+
+			var output strings.Builder
+			stream, err := NewStream(strings.NewReader(test.document), []string{"items"}, program, 50)
+			if err == nil {
+				err = stream.Rewrite(context.Background(), code, Context{}, &output)
+			}
+
+			if (err != nil) != test.err {
+				t.Errorf("got error %v, want error %t", err, test.err)
+			}
+		})
+	}
+}
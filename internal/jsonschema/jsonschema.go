@@ -0,0 +1,649 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema. The validation keywords of draft 4 up to 2020-12 are
+// supported, except for the keywords that depend on annotations, such as
+// unevaluatedProperties, and for formats, which are not asserted. References
+// can only point into the document of the schema.
+type Schema struct {
+	root     interface{}
+	entry    interface{}
+	patterns map[string]*regexp.Regexp
+	prepared map[string]bool
+	acyclic  map[string]bool
+}
+
+// schemaKeywords are the keywords of which the value is a schema or an array of
+// schemas, and schemaMapKeywords those of which the value is an object of
+// schemas.
+var (
+	schemaKeywords    = []string{"items", "prefixItems", "additionalItems", "additionalProperties", "contains", "propertyNames", "allOf", "anyOf", "oneOf", "not", "if", "then", "else"}
+	schemaMapKeywords = []string{"properties", "patternProperties", "definitions", "$defs", "dependencies", "dependentSchemas"}
+)
+
+// inPlaceKeywords are the keywords of which the schemas apply to the value
+// itself rather than to a part of it.
+var (
+	inPlaceKeywords    = []string{"allOf", "anyOf", "oneOf", "not", "if", "then", "else"}
+	inPlaceMapKeywords = []string{"dependencies", "dependentSchemas"}
+)
+
+// Violation is a part of a JSON document that does not match a schema. Path is
+// the JSON pointer of the part, which is empty for the document itself.
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+
+	return v.Path + ": " + v.Message
+}
+
+// Load reads a schema from a JSON file.
+func Load(file string) (*Schema, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses a schema. Patterns are compiled and references resolved, so
+// that errors in the schema are reported here rather than during validation.
+func Parse(data []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	return New(root)
+}
+
+// New returns the schema of a decoded JSON value.
+func New(root interface{}) (*Schema, error) {
+	return NewIn(root, root)
+}
+
+// NewIn returns a schema that is part of a larger document, such as a schema of
+// an OpenAPI document, against which its references are resolved.
+func NewIn(document interface{}, schema interface{}) (*Schema, error) {
+	s := &Schema{
+		root:     document,
+		entry:    schema,
+		patterns: map[string]*regexp.Regexp{},
+		prepared: map[string]bool{},
+		acyclic:  map[string]bool{},
+	}
+	if err := s.prepare(schema); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// prepare compiles the patterns and checks the references of a schema and its
+// subschemas, including the schemas it refers to.
+func (s *Schema) prepare(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if err := s.checkCycle(v, nil); err != nil {
+			return err
+		}
+
+		if ref, ok := v["$ref"].(string); ok && !s.prepared[ref] {
+			s.prepared[ref] = true
+
+			target, err := s.resolve(ref)
+			if err != nil {
+				return err
+			}
+
+			if err := s.prepare(target); err != nil {
+				return err
+			}
+		}
+
+		if pattern, ok := v["pattern"].(string); ok {
+			if err := s.compile(pattern); err != nil {
+				return err
+			}
+		}
+
+		if patternProperties, ok := v["patternProperties"].(map[string]interface{}); ok {
+			for pattern := range patternProperties {
+				if err := s.compile(pattern); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, keyword := range schemaMapKeywords {
+			if schemas, ok := v[keyword].(map[string]interface{}); ok {
+				for _, child := range schemas {
+					if err := s.prepare(child); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for _, keyword := range schemaKeywords {
+			if child, ok := v[keyword]; ok {
+				if err := s.prepare(child); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if err := s.prepare(child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkCycle returns an error when a schema refers to itself without
+// descending into a part of the value, such as a definition A of
+// {"allOf": [{"$ref": "#/definitions/A"}]}, which would validate a value
+// forever. refs are the references followed to reach the schema.
+func (s *Schema) checkCycle(schema interface{}, refs []string) error {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok && !s.acyclic[ref] {
+			for _, followed := range refs {
+				if followed == ref {
+					return fmt.Errorf("reference cycle %s", strings.Join(append(refs, ref), " -> "))
+				}
+			}
+
+			target, err := s.resolve(ref)
+			if err != nil {
+				return err
+			}
+
+			if err := s.checkCycle(target, append(refs, ref)); err != nil {
+				return err
+			}
+
+			s.acyclic[ref] = true
+		}
+
+		for _, keyword := range inPlaceKeywords {
+			if err := s.checkCycle(v[keyword], refs); err != nil {
+				return err
+			}
+		}
+
+		for _, keyword := range inPlaceMapKeywords {
+			schemas, _ := v[keyword].(map[string]interface{})
+			for _, child := range schemas {
+				if err := s.checkCycle(child, refs); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if err := s.checkCycle(child, refs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) compile(pattern string) error {
+	if _, ok := s.patterns[pattern]; ok {
+		return nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	s.patterns[pattern] = compiled
+	return nil
+}
+
+// resolve returns the subschema a reference such as #/definitions/name points
+// to.
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("unsupported reference %q", ref)
+	}
+
+	current := s.root
+	if pointer == "" {
+		return current, nil
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		switch v := current.(type) {
+		case map[string]interface{}:
+			child, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("unresolvable reference %q", ref)
+			}
+			current = child
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("unresolvable reference %q", ref)
+			}
+			current = v[index]
+		default:
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+	}
+
+	return current, nil
+}
+
+// Validate returns the violations of a decoded JSON value, in which numbers are
+// float64 values as decoded by encoding/json.
+func (s *Schema) Validate(value interface{}) []Violation {
+	var violations []Violation
+	s.validate(s.entry, value, "", &violations)
+	return violations
+}
+
+func (s *Schema) validate(schema interface{}, value interface{}, path string, violations *[]Violation) {
+	report := func(format string, args ...interface{}) {
+		*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			report("no value is allowed")
+		}
+		return
+	}
+
+	keywords, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if ref, ok := keywords["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err == nil {
+			s.validate(target, value, path, violations)
+		}
+	}
+
+	// nullable is the OpenAPI 3.0 way to allow null besides the type.
+	nullable, _ := keywords["nullable"].(bool)
+	if types, ok := keywords["type"]; ok && !(nullable && value == nil) && !matchesType(types, value) {
+		report("expected %s, got %s", describeTypes(types), typeOf(value))
+		return
+	}
+
+	if enum, ok := keywords["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if equal(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value must be one of %s", encode(enum))
+		}
+	}
+
+	if constant, ok := keywords["const"]; ok && !equal(constant, value) {
+		report("value must be %s", encode(constant))
+	}
+
+	switch v := value.(type) {
+	case string:
+		s.validateString(keywords, v, report)
+	case float64:
+		validateNumber(keywords, v, report)
+	case []interface{}:
+		s.validateArray(keywords, v, path, violations, report)
+	case map[string]interface{}:
+		s.validateObject(keywords, v, path, violations, report)
+	}
+
+	if allOf, ok := keywords["allOf"].([]interface{}); ok {
+		for _, subschema := range allOf {
+			s.validate(subschema, value, path, violations)
+		}
+	}
+
+	if anyOf, ok := keywords["anyOf"].([]interface{}); ok {
+		if s.countMatches(anyOf, value, path) == 0 {
+			report("value does not match any of the anyOf schemas")
+		}
+	}
+
+	if oneOf, ok := keywords["oneOf"].([]interface{}); ok {
+		if matched := s.countMatches(oneOf, value, path); matched != 1 {
+			report("value matches %d instead of exactly one of the oneOf schemas", matched)
+		}
+	}
+
+	if not, ok := keywords["not"]; ok && s.matches(not, value, path) {
+		report("value must not match the not schema")
+	}
+
+	if condition, ok := keywords["if"]; ok {
+		if s.matches(condition, value, path) {
+			if then, ok := keywords["then"]; ok {
+				s.validate(then, value, path, violations)
+			}
+		} else if otherwise, ok := keywords["else"]; ok {
+			s.validate(otherwise, value, path, violations)
+		}
+	}
+}
+
+func (s *Schema) matches(schema interface{}, value interface{}, path string) bool {
+	var violations []Violation
+	s.validate(schema, value, path, &violations)
+	return len(violations) == 0
+}
+
+func (s *Schema) countMatches(schemas []interface{}, value interface{}, path string) int {
+	matched := 0
+	for _, schema := range schemas {
+		if s.matches(schema, value, path) {
+			matched++
+		}
+	}
+
+	return matched
+}
+
+func (s *Schema) validateString(keywords map[string]interface{}, value string, report func(string, ...interface{})) {
+	length := utf8.RuneCountInString(value)
+
+	if minLength, ok := number(keywords["minLength"]); ok && float64(length) < minLength {
+		report("string must be at least %v characters long", minLength)
+	}
+
+	if maxLength, ok := number(keywords["maxLength"]); ok && float64(length) > maxLength {
+		report("string must be at most %v characters long", maxLength)
+	}
+
+	if pattern, ok := keywords["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+		report("string must match the pattern %q", pattern)
+	}
+}
+
+func validateNumber(keywords map[string]interface{}, value float64, report func(string, ...interface{})) {
+	if minimum, ok := number(keywords["minimum"]); ok {
+		if exclusive, _ := keywords["exclusiveMinimum"].(bool); exclusive && value <= minimum {
+			report("number must be greater than %v", minimum)
+		} else if value < minimum {
+			report("number must be at least %v", minimum)
+		}
+	}
+
+	if maximum, ok := number(keywords["maximum"]); ok {
+		if exclusive, _ := keywords["exclusiveMaximum"].(bool); exclusive && value >= maximum {
+			report("number must be less than %v", maximum)
+		} else if value > maximum {
+			report("number must be at most %v", maximum)
+		}
+	}
+
+	if minimum, ok := number(keywords["exclusiveMinimum"]); ok && value <= minimum {
+		report("number must be greater than %v", minimum)
+	}
+
+	if maximum, ok := number(keywords["exclusiveMaximum"]); ok && value >= maximum {
+		report("number must be less than %v", maximum)
+	}
+
+	if multipleOf, ok := number(keywords["multipleOf"]); ok && multipleOf > 0 {
+		if quotient := value / multipleOf; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			report("number must be a multiple of %v", multipleOf)
+		}
+	}
+}
+
+func (s *Schema) validateArray(keywords map[string]interface{}, value []interface{}, path string, violations *[]Violation, report func(string, ...interface{})) {
+	if minItems, ok := number(keywords["minItems"]); ok && float64(len(value)) < minItems {
+		report("array must have at least %v items", minItems)
+	}
+
+	if maxItems, ok := number(keywords["maxItems"]); ok && float64(len(value)) > maxItems {
+		report("array must have at most %v items", maxItems)
+	}
+
+	if unique, _ := keywords["uniqueItems"].(bool); unique {
+	unique:
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					report("array items must be unique")
+					break unique
+				}
+			}
+		}
+	}
+
+	// Items before the prefixItems of 2020-12 or the array form of items of
+	// earlier drafts are validated against their own schema, the rest against
+	// items or additionalItems.
+	var prefix []interface{}
+	rest, hasRest := keywords["items"]
+	if prefixItems, ok := keywords["prefixItems"].([]interface{}); ok {
+		prefix = prefixItems
+	} else if items, ok := rest.([]interface{}); ok {
+		prefix = items
+		rest, hasRest = keywords["additionalItems"]
+	}
+
+	for i, item := range value {
+		itemPath := path + "/" + strconv.Itoa(i)
+		switch {
+		case i < len(prefix):
+			s.validate(prefix[i], item, itemPath, violations)
+		case hasRest:
+			s.validate(rest, item, itemPath, violations)
+		}
+	}
+
+	if contains, ok := keywords["contains"]; ok {
+		found := false
+		for i, item := range value {
+			if s.matches(contains, item, path+"/"+strconv.Itoa(i)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("array must contain an item that matches the contains schema")
+		}
+	}
+}
+
+func (s *Schema) validateObject(keywords map[string]interface{}, value map[string]interface{}, path string, violations *[]Violation, report func(string, ...interface{})) {
+	if minProperties, ok := number(keywords["minProperties"]); ok && float64(len(value)) < minProperties {
+		report("object must have at least %v properties", minProperties)
+	}
+
+	if maxProperties, ok := number(keywords["maxProperties"]); ok && float64(len(value)) > maxProperties {
+		report("object must have at most %v properties", maxProperties)
+	}
+
+	if required, ok := keywords["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := value[name]; !ok {
+					report("missing required property %q", name)
+				}
+			}
+		}
+	}
+
+	// dependencies of draft 4 to 7 was split into dependentRequired and
+	// dependentSchemas in 2019-09.
+	for _, keyword := range []string{"dependencies", "dependentRequired", "dependentSchemas"} {
+		dependencies, _ := keywords[keyword].(map[string]interface{})
+		for name, dependency := range dependencies {
+			if _, ok := value[name]; !ok {
+				continue
+			}
+
+			if required, ok := dependency.([]interface{}); ok {
+				for _, dependent := range required {
+					if dependent, ok := dependent.(string); ok {
+						if _, ok := value[dependent]; !ok {
+							report("property %q is required by property %q", dependent, name)
+						}
+					}
+				}
+				continue
+			}
+
+			s.validate(dependency, value, path, violations)
+		}
+	}
+
+	properties, _ := keywords["properties"].(map[string]interface{})
+	patternProperties, _ := keywords["patternProperties"].(map[string]interface{})
+	additionalProperties, hasAdditional := keywords["additionalProperties"]
+	propertyNames, hasPropertyNames := keywords["propertyNames"]
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+		property := value[name]
+
+		if hasPropertyNames && !s.matches(propertyNames, name, propertyPath) {
+			report("property name %q is not allowed", name)
+		}
+
+		matched := false
+		if schema, ok := properties[name]; ok {
+			matched = true
+			s.validate(schema, property, propertyPath, violations)
+		}
+
+		for pattern, schema := range patternProperties {
+			if s.patterns[pattern].MatchString(name) {
+				matched = true
+				s.validate(schema, property, propertyPath, violations)
+			}
+		}
+
+		if matched || !hasAdditional {
+			continue
+		}
+
+		if allowed, ok := additionalProperties.(bool); ok && !allowed {
+			report("property %q is not allowed", name)
+			continue
+		}
+
+		s.validate(additionalProperties, property, propertyPath, violations)
+	}
+}
+
+func matchesType(types interface{}, value interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return matchesSingleType(t, value)
+	case []interface{}:
+		for _, single := range t {
+			if name, ok := single.(string); ok && matchesSingleType(name, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func matchesSingleType(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	default:
+		return typeOf(value) == name
+	}
+}
+
+func describeTypes(types interface{}) string {
+	if list, ok := types.([]interface{}); ok {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+
+	return fmt.Sprint(types)
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+func equal(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func encode(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(encoded)
+}
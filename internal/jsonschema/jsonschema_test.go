@@ -0,0 +1,118 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["bsn"],
+		"additionalProperties": false,
+		"properties": {
+			"bsn": {"type": "string", "pattern": "^[0-9]{9}$"},
+			"leeftijd": {"type": "integer", "minimum": 0},
+			"geslacht": {"enum": ["man", "vrouw", "onbekend"]},
+			"adressen": {"type": "array", "items": {"$ref": "#/definitions/adres"}},
+			"partner": {"$ref": "#"},
+			"contact": {"oneOf": [{"required": ["email"]}, {"required": ["telefoon"]}]}
+		},
+		"definitions": {
+			"adres": {
+				"type": "object",
+				"required": ["postcode"],
+				"properties": {"postcode": {"type": "string", "maxLength": 6}}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		document string
+		want     []string
+	}{
+		{"valid", `{"bsn": "999993653", "leeftijd": 42, "adressen": [{"postcode": "1234AB"}]}`, nil},
+		{"missing required property", `{}`, []string{`missing required property "bsn"`}},
+		{"wrong type", `{"bsn": 999993653}`, []string{"/bsn: expected string, got number"}},
+		{"pattern", `{"bsn": "12345"}`, []string{"/bsn: string must match the pattern"}},
+		{"integer", `{"bsn": "999993653", "leeftijd": 4.5}`, []string{"/leeftijd: expected integer"}},
+		{"minimum", `{"bsn": "999993653", "leeftijd": -1}`, []string{"/leeftijd: number must be at least 0"}},
+		{"enum", `{"bsn": "999993653", "geslacht": "x"}`, []string{"/geslacht: value must be one of"}},
+		{"additional property", `{"bsn": "999993653", "naam": "Jan"}`, []string{`property "naam" is not allowed`}},
+		{"reference", `{"bsn": "999993653", "adressen": [{"postcode": "1234ABC"}]}`, []string{"/adressen/0/postcode: string must be at most 6 characters long"}},
+		{"recursive reference", `{"bsn": "999993653", "partner": {}}`, []string{`/partner: missing required property "bsn"`}},
+		{"oneOf", `{"bsn": "999993653", "contact": {"email": "a", "telefoon": "b"}}`, []string{"/contact: value matches 2 instead of exactly one"}},
+	}
+
+	compiled, err := Parse([]byte(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var document interface{}
+			if err := json.Unmarshal([]byte(test.document), &document); err != nil {
+				t.Fatal(err)
+			}
+
+			violations := compiled.Validate(document)
+			if len(violations) != len(test.want) {
+				t.Fatalf("Validate() = %v, want %d violations", violations, len(test.want))
+			}
+
+			for i, violation := range violations {
+				if !strings.HasPrefix(violation.String(), test.want[i]) {
+					t.Errorf("violation %d = %q, want it to start with %q", i, violation, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalidSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{"invalid pattern", `{"pattern": "("}`, "invalid pattern"},
+		{"unresolvable reference", `{"$ref": "#/definitions/missing"}`, "unresolvable reference"},
+		{"external reference", `{"$ref": "other.json#/definitions/a"}`, "unsupported reference"},
+		{"reference to itself", `{"definitions": {"a": {"$ref": "#/definitions/a"}}}`, "reference cycle"},
+		{"cycle through allOf", `{"definitions": {"a": {"allOf": [{"$ref": "#/definitions/a"}]}}}`, "reference cycle"},
+		{"cycle through the root", `{"anyOf": [{"not": {"$ref": "#"}}]}`, "reference cycle"},
+		{"cycle through two definitions", `{"$ref": "#/$defs/a", "$defs": {"a": {"if": {"$ref": "#/$defs/b"}}, "b": {"oneOf": [{"$ref": "#/$defs/a"}]}}}`, "reference cycle"},
+		{"cycle through dependentSchemas", `{"definitions": {"a": {"dependentSchemas": {"x": {"$ref": "#/definitions/a"}}}}}`, "reference cycle"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.schema))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Parse() error = %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseRecursiveSchema(t *testing.T) {
+	// A reference back to a schema below properties or items descends into the
+	// value, so that validation ends with the value.
+	schema := `{"$defs": {"node": {"properties": {"children": {"items": {"$ref": "#/$defs/node"}}}, "allOf": [{"$ref": "#/$defs/leaf"}]}, "leaf": {"type": "object"}}, "$ref": "#/$defs/node"}`
+
+	compiled, err := Parse([]byte(schema))
+	if err != nil {
+		t.Fatalf("Parse() error = %s", err)
+	}
+
+	var document interface{}
+	json.Unmarshal([]byte(`{"children": [{"children": [1]}]}`), &document)
+
+	violations := compiled.Validate(document)
+	if len(violations) != 1 || violations[0].Path != "/children/0/children/0" {
+		t.Errorf("Validate() = %v, want one violation at /children/0/children/0", violations)
+	}
+}
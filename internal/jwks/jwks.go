@@ -0,0 +1,244 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// refreshInterval is the minimum time between two fetches of the key set, so
+// that tokens with unknown key ids do not cause a fetch for every request.
+// After a failed fetch the set is fetched again after retryInterval.
+const (
+	refreshInterval = time.Minute
+	retryInterval   = 5 * time.Second
+)
+
+// ValidMethods are the signing methods accepted for tokens verified with a key
+// set.
+var ValidMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// KeySet is a JSON Web Key Set fetched from a URL. The keys are fetched again
+// when a token refers to a key id that is not in the set.
+type KeySet struct {
+	url      string
+	issuer   string
+	audience string
+	client   *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+	failed  time.Time
+	// fetching is closed when the running fetch completes, so that concurrent
+	// requests wait for it instead of fetching the set again.
+	fetching chan struct{}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// New returns the key set at url. The keys are fetched on first use. Tokens
+// have to be issued by issuer and for audience, unless these are empty.
+func New(url string, issuer string, audience string) *KeySet {
+	return &KeySet{
+		url:      url,
+		issuer:   issuer,
+		audience: audience,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Parse parses a token and verifies its signature and registered claims,
+// including the issuer and audience of the key set.
+func (k *KeySet) Parse(token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(ValidMethods))
+	if _, err := parser.ParseWithClaims(token, claims, k.key); err != nil {
+		return nil, err
+	}
+
+	if k.issuer != "" && !claims.VerifyIssuer(k.issuer, true) {
+		return nil, errors.New("token has an invalid issuer")
+	}
+
+	if k.audience != "" && !claims.VerifyAudience(k.audience, true) {
+		return nil, errors.New("token has an invalid audience")
+	}
+
+	return claims, nil
+}
+
+// key returns the public key for the key id in the header of a token. The key
+// set is fetched without holding the lock, so that tokens with known keys are
+// verified while a fetch is running.
+func (k *KeySet) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.Lock()
+	for {
+		if key, ok := k.lookup(kid); ok {
+			k.mu.Unlock()
+			return key, nil
+		}
+
+		if k.fetching == nil {
+			break
+		}
+
+		fetching := k.fetching
+		k.mu.Unlock()
+		<-fetching
+		k.mu.Lock()
+	}
+
+	if time.Since(k.fetched) < refreshInterval || time.Since(k.failed) < retryInterval {
+		k.mu.Unlock()
+		return nil, errUnknownKey
+	}
+
+	fetching := make(chan struct{})
+	k.fetching = fetching
+	k.mu.Unlock()
+
+	keys, err := k.fetch()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.fetching = nil
+	close(fetching)
+
+	if err != nil {
+		k.failed = time.Now()
+		return nil, err
+	}
+
+	k.keys, k.fetched = keys, time.Now()
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, errUnknownKey
+}
+
+// lookup returns the key with a key id, or the only key of the set for tokens
+// without a key id.
+func (k *KeySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// fetch fetches the keys of the set that can be used to verify signatures.
+func (k *KeySet) fetch() (map[string]interface{}, error) {
+	response, err := k.client.Get(k.url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks url returned status %d", response.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
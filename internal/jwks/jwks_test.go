@@ -0,0 +1,207 @@
+package jwks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestParse(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(keySet("key-1", &privateKey.PublicKey))
+	}))
+	defer server.Close()
+
+	keys := New(server.URL, "", "")
+
+	claims, err := keys.Parse(sign(t, privateKey, "key-1", time.Hour))
+	if err != nil {
+		t.Fatalf("Parse() error = %s", err)
+	}
+
+	if claims["sub"] != "gebruiker" {
+		t.Errorf("sub = %v, want gebruiker", claims["sub"])
+	}
+
+	if _, err := keys.Parse(sign(t, privateKey, "key-1", -time.Hour)); err == nil {
+		t.Error("Parse() accepted an expired token")
+	}
+
+	if _, err := keys.Parse(sign(t, privateKey, "key-2", time.Hour)); err == nil {
+		t.Error("Parse() accepted a token with an unknown key id")
+	}
+
+	if fetches != 1 {
+		t.Errorf("the key set was fetched %d times, want 1 within the refresh interval", fetches)
+	}
+}
+
+func TestParseDuringFetch(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(keySet("key-1", &privateKey.PublicKey))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	keys := New(server.URL, "", "")
+	keys.keys = map[string]interface{}{"key-0": &privateKey.PublicKey}
+	keys.fetched = time.Now().Add(-refreshInterval)
+
+	// A token with an unknown key id starts a fetch that blocks until release
+	// is closed.
+	go keys.Parse(sign(t, privateKey, "key-1", time.Hour))
+
+	for {
+		keys.mu.Lock()
+		fetching := keys.fetching != nil
+		keys.mu.Unlock()
+		if fetching {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := keys.Parse(sign(t, privateKey, "key-0", time.Hour))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Parse() error = %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a token with a known key waited for the running fetch")
+	}
+}
+
+func TestParseIssuerAudience(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keySet("key-1", &privateKey.PublicKey))
+	}))
+	defer server.Close()
+
+	keys := New(server.URL, "https://idp.example.com", "filter-proxy")
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"issuer and audience", jwt.MapClaims{"iss": "https://idp.example.com", "aud": "filter-proxy"}, true},
+		{"one of the audiences", jwt.MapClaims{"iss": "https://idp.example.com", "aud": []string{"other", "filter-proxy"}}, true},
+		{"other issuer", jwt.MapClaims{"iss": "https://other.example.com", "aud": "filter-proxy"}, false},
+		{"other audience", jwt.MapClaims{"iss": "https://idp.example.com", "aud": "other"}, false},
+		{"without issuer and audience", jwt.MapClaims{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.claims["exp"] = time.Now().Add(time.Hour).Unix()
+			if _, err := keys.Parse(signClaims(t, privateKey, "key-1", test.claims)); (err == nil) != test.valid {
+				t.Errorf("Parse() error = %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestParseAfterFailedFetch(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(keySet("key-1", &privateKey.PublicKey))
+	}))
+	defer server.Close()
+
+	keys := New(server.URL, "", "")
+	token := sign(t, privateKey, "key-1", time.Hour)
+
+	if _, err := keys.Parse(token); err == nil {
+		t.Fatal("Parse() succeeded while the key set could not be fetched")
+	}
+
+	if _, err := keys.Parse(token); err == nil || fetches != 1 {
+		t.Errorf("Parse() error = %v after %d fetches, want the failed fetch not to be retried at once", err, fetches)
+	}
+
+	// A failed fetch does not delay the next one by the refresh interval.
+	keys.failed = time.Now().Add(-retryInterval)
+	if _, err := keys.Parse(token); err != nil {
+		t.Errorf("Parse() error = %s, want the key set to be fetched again", err)
+	}
+}
+
+func keySet(kid string, key *rsa.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"keys": []interface{}{
+			map[string]interface{}{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	}
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, validity time.Duration) string {
+	t.Helper()
+
+	return signClaims(t, key, kid, jwt.MapClaims{
+		"sub": "gebruiker",
+		"exp": time.Now().Add(validity).Unix(),
+	})
+}
+
+func signClaims(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
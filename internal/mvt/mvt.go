@@ -0,0 +1,385 @@
+package mvt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+// Field numbers of the Mapbox Vector Tile protobuf schema (version 2.1).
+const (
+	tileLayers = 3
+
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+
+	featureTags = 2
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errInvalidTile = errors.New("invalid vector tile")
+
+// IsVectorTile reports whether a content type is that of a Mapbox Vector Tile.
+func IsVectorTile(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "mapbox-vector-tile") || strings.Contains(contentType, "x-protobuf")
+}
+
+// IsVectorTileRequest reports whether a request asks for a Mapbox Vector Tile,
+// through the FORMAT parameter of WMS and WMTS, the f parameter of OGC API -
+// Tiles, the extension of a TMS or XYZ tile path or its Accept header. The
+// query parameters have to be lowercased. The decision does not depend on the
+// response, so that a backend can not skip filtering by changing its content
+// type.
+func IsVectorTileRequest(path string, queryParams url.Values, accept string) bool {
+	for _, format := range []string{queryParams.Get("format"), queryParams.Get("f"), accept} {
+		if format = strings.ToLower(format); IsVectorTile(format) || format == "mvt" || format == "pbf" {
+			return true
+		}
+	}
+
+	path = strings.ToLower(path)
+	return strings.HasSuffix(path, ".pbf") || strings.HasSuffix(path, ".mvt") || strings.Contains(path, "@pbf/")
+}
+
+// Filter removes the layers that are not allowed by resources and the
+// attributes that are not allowed by policy from a vector tile. A nil
+// resources map allows all layers. Layers are matched on their full name or on
+// their name without workspace. Gzip compressed tiles are compressed again
+// after filtering, and may not exceed maxSize bytes when decompressed if it is
+// positive. Anything that is not a well-formed tile, including tiles with
+// fields besides layers or with layers without a name, is rejected.
+func Filter(tile []byte, resources map[string]bool, policy feature.AttributePolicy, maxSize int64) ([]byte, error) {
+	if bytes.HasPrefix(tile, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(tile))
+		if err != nil {
+			return nil, err
+		}
+
+		reader := io.Reader(gz)
+		if maxSize > 0 {
+			reader = io.LimitReader(gz, maxSize+1)
+		}
+
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if maxSize > 0 && int64(len(decompressed)) > maxSize {
+			return nil, fmt.Errorf("decompressed tile exceeds the maximum size of %d bytes", maxSize)
+		}
+
+		filtered, err := Filter(decompressed, resources, policy, maxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(filtered); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		return compressed.Bytes(), nil
+	}
+
+	var filtered []byte
+	err := eachField(tile, func(field int, wireType int, raw []byte, value []byte) error {
+		if field != tileLayers || wireType != wireBytes {
+			return errInvalidTile
+		}
+
+		name, err := layerNameOf(value)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return errInvalidTile
+		}
+
+		if !layerAllowed(resources, name) {
+			return nil
+		}
+
+		allowed, restricted := policy.Restricted(name)
+		if !restricted {
+			filtered = append(filtered, raw...)
+			return nil
+		}
+
+		layer, err := filterLayer(value, allowed)
+		if err != nil {
+			return err
+		}
+
+		filtered = appendBytesField(filtered, tileLayers, layer)
+		return nil
+	})
+
+	return filtered, err
+}
+
+func layerAllowed(resources map[string]bool, name string) bool {
+	if resources == nil {
+		return true
+	}
+
+	if allowed, ok := resources[name]; ok {
+		return allowed
+	}
+
+	for resource, allowed := range resources {
+		if feature.LocalName(resource) == name {
+			return allowed
+		}
+	}
+
+	return false
+}
+
+func layerNameOf(layer []byte) (string, error) {
+	var name string
+	err := eachField(layer, func(field int, wireType int, raw []byte, value []byte) error {
+		if field == layerName && wireType == wireBytes {
+			name = string(value)
+		}
+		return nil
+	})
+
+	return name, err
+}
+
+// filterLayer removes the keys that are not allowed from a layer, together with
+// the values that are no longer used by any feature, and renumbers the tags of
+// the features accordingly.
+func filterLayer(layer []byte, allowed []string) ([]byte, error) {
+	var (
+		keys     []string
+		values   [][]byte
+		features [][]byte
+	)
+
+	err := eachField(layer, func(field int, wireType int, raw []byte, value []byte) error {
+		switch {
+		case field == layerKeys && wireType == wireBytes:
+			keys = append(keys, string(value))
+		case field == layerValues && wireType == wireBytes:
+			values = append(values, value)
+		case field == layerFeatures && wireType == wireBytes:
+			features = append(features, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	allowedKeys := map[string]bool{}
+	for _, key := range allowed {
+		allowedKeys[key] = true
+	}
+
+	keyIndex := map[uint64]uint64{}
+	var keptKeys []string
+	for i, key := range keys {
+		if allowedKeys[key] {
+			keyIndex[uint64(i)] = uint64(len(keptKeys))
+			keptKeys = append(keptKeys, key)
+		}
+	}
+
+	valueIndex := map[uint64]uint64{}
+	var keptValues [][]byte
+	var filteredFeatures [][]byte
+	for _, f := range features {
+		filteredFeature, err := filterFeature(f, func(key uint64, value uint64) (uint64, uint64, bool) {
+			newKey, ok := keyIndex[key]
+			if !ok || value >= uint64(len(values)) {
+				return 0, 0, false
+			}
+
+			newValue, ok := valueIndex[value]
+			if !ok {
+				newValue = uint64(len(keptValues))
+				valueIndex[value] = newValue
+				keptValues = append(keptValues, values[value])
+			}
+
+			return newKey, newValue, true
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		filteredFeatures = append(filteredFeatures, filteredFeature)
+	}
+
+	var filtered []byte
+	err = eachField(layer, func(field int, wireType int, raw []byte, value []byte) error {
+		switch field {
+		case layerFeatures, layerKeys, layerValues:
+			// Written below.
+		default:
+			filtered = append(filtered, raw...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range filteredFeatures {
+		filtered = appendBytesField(filtered, layerFeatures, f)
+	}
+	for _, key := range keptKeys {
+		filtered = appendBytesField(filtered, layerKeys, []byte(key))
+	}
+	for _, value := range keptValues {
+		filtered = appendBytesField(filtered, layerValues, value)
+	}
+
+	return filtered, nil
+}
+
+// filterFeature rewrites the tags of a feature, which are pairs of key and
+// value indices. Pairs for which remap returns false are removed.
+func filterFeature(f []byte, remap func(key uint64, value uint64) (uint64, uint64, bool)) ([]byte, error) {
+	var filtered []byte
+	var tags []uint64
+
+	err := eachField(f, func(field int, wireType int, raw []byte, value []byte) error {
+		if field != featureTags || wireType != wireBytes {
+			filtered = append(filtered, raw...)
+			return nil
+		}
+
+		for len(value) > 0 {
+			tag, n := readVarint(value)
+			if n <= 0 {
+				return errInvalidTile
+			}
+
+			tags = append(tags, tag)
+			value = value[n:]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tags)%2 != 0 {
+		return nil, errInvalidTile
+	}
+
+	var packed []byte
+	for i := 0; i < len(tags); i += 2 {
+		key, value, ok := remap(tags[i], tags[i+1])
+		if ok {
+			packed = appendVarint(appendVarint(packed, key), value)
+		}
+	}
+
+	if len(packed) > 0 {
+		filtered = appendBytesField(filtered, featureTags, packed)
+	}
+
+	return filtered, nil
+}
+
+// eachField calls fn for every field of a protobuf message with the raw bytes
+// of the field and, for length delimited fields, its value.
+func eachField(message []byte, fn func(field int, wireType int, raw []byte, value []byte) error) error {
+	for len(message) > 0 {
+		key, n := readVarint(message)
+		if n <= 0 {
+			return errInvalidTile
+		}
+
+		field, wireType := int(key>>3), int(key&7)
+		length := n
+		var value []byte
+
+		switch wireType {
+		case wireVarint:
+			_, m := readVarint(message[n:])
+			if m <= 0 {
+				return errInvalidTile
+			}
+			length += m
+		case wireFixed64:
+			length += 8
+		case wireFixed32:
+			length += 4
+		case wireBytes:
+			size, m := readVarint(message[n:])
+			if m <= 0 || size > uint64(len(message)-n-m) {
+				return errInvalidTile
+			}
+			value = message[n+m : n+m+int(size)]
+			length += m + int(size)
+		default:
+			return errInvalidTile
+		}
+
+		if length > len(message) {
+			return errInvalidTile
+		}
+
+		if err := fn(field, wireType, message[:length], value); err != nil {
+			return err
+		}
+
+		message = message[length:]
+	}
+
+	return nil
+}
+
+// readVarint returns a varint and its length, which is zero or negative when
+// the varint is incomplete or too long.
+func readVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		value |= uint64(data[i]&0x7f) << (7 * i)
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+
+	return 0, -1
+}
+
+func appendVarint(data []byte, value uint64) []byte {
+	for value >= 0x80 {
+		data = append(data, byte(value)|0x80)
+		value >>= 7
+	}
+
+	return append(data, byte(value))
+}
+
+func appendBytesField(data []byte, field int, value []byte) []byte {
+	data = appendVarint(data, uint64(field)<<3|wireBytes)
+	data = appendVarint(data, uint64(len(value)))
+	return append(data, value...)
+}
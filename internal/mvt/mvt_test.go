@@ -0,0 +1,200 @@
+package mvt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+// testLayer encodes a layer with a single feature that has a value for every
+// key.
+func testLayer(name string, keys ...string) []byte {
+	layer := appendBytesField(nil, layerName, []byte(name))
+
+	var tags []byte
+	for i, key := range keys {
+		layer = appendBytesField(layer, layerKeys, []byte(key))
+		layer = appendBytesField(layer, layerValues, appendBytesField(nil, 1, []byte(key+" value")))
+		tags = appendVarint(appendVarint(tags, uint64(i)), uint64(i))
+	}
+
+	return appendBytesField(layer, layerFeatures, appendBytesField(nil, featureTags, tags))
+}
+
+func testTile(layers ...[]byte) []byte {
+	var tile []byte
+	for _, layer := range layers {
+		tile = appendBytesField(tile, tileLayers, layer)
+	}
+
+	return tile
+}
+
+// decodeTile returns the keys of every layer of a tile and the keys of the
+// tags of their features.
+func decodeTile(t *testing.T, tile []byte) map[string][]string {
+	t.Helper()
+
+	layers := map[string][]string{}
+	err := eachField(tile, func(field int, wireType int, raw []byte, value []byte) error {
+		name, _ := layerNameOf(value)
+
+		var keys []string
+		var tags []uint64
+		err := eachField(value, func(field int, wireType int, raw []byte, value []byte) error {
+			switch field {
+			case layerKeys:
+				keys = append(keys, string(value))
+			case layerFeatures:
+				return eachField(value, func(field int, wireType int, raw []byte, value []byte) error {
+					for len(value) > 0 {
+						tag, n := readVarint(value)
+						tags = append(tags, tag)
+						value = value[n:]
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+
+		var tagged []string
+		for i := 0; i < len(tags); i += 2 {
+			tagged = append(tagged, keys[tags[i]])
+		}
+
+		layers[name] = tagged
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return layers
+}
+
+func TestFilter(t *testing.T) {
+	tile := testTile(testLayer("percelen", "naam", "eigenaar"), testLayer("wegen", "naam"))
+
+	tests := []struct {
+		name      string
+		resources map[string]bool
+		policy    feature.AttributePolicy
+		want      map[string][]string
+	}{
+		{
+			name: "no restrictions",
+			want: map[string][]string{"percelen": {"naam", "eigenaar"}, "wegen": {"naam"}},
+		},
+		{
+			name:      "allowed layers",
+			resources: map[string]bool{"brk:percelen": true},
+			want:      map[string][]string{"percelen": {"naam", "eigenaar"}},
+		},
+		{
+			name:   "allowed attributes",
+			policy: feature.AttributePolicy{"percelen": {"naam"}},
+			want:   map[string][]string{"percelen": {"naam"}, "wegen": {"naam"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filtered, err := Filter(tile, test.resources, test.policy, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := decodeTile(t, filtered); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(testTile(testLayer("percelen", "naam"), testLayer("wegen", "naam")))
+	writer.Close()
+
+	filtered, err := Filter(compressed.Bytes(), map[string]bool{"wegen": true}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(filtered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := decodeTile(t, decompressed); !reflect.DeepEqual(got, map[string][]string{"wegen": {"naam"}}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestFilterGzipMaxSize(t *testing.T) {
+	tile := testTile(testLayer("percelen", "naam"), testLayer("wegen", "naam"))
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(tile)
+	writer.Close()
+
+	if _, err := Filter(compressed.Bytes(), nil, nil, int64(len(tile))); err != nil {
+		t.Errorf("unexpected error for a tile of the maximum size: %v", err)
+	}
+
+	_, err := Filter(compressed.Bytes(), nil, nil, int64(len(tile)-1))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum size") {
+		t.Errorf("got error %v, want the decompressed tile to exceed the maximum size", err)
+	}
+}
+
+func TestFilterRejectsInvalidTiles(t *testing.T) {
+	tests := map[string][]byte{
+		"json":               []byte(`{"type":"FeatureCollection","features":[]}`),
+		"xml":                []byte(`<ServiceExceptionReport/>`),
+		"truncated":          testTile(testLayer("percelen", "naam"))[:10],
+		"layer without name": testTile(appendBytesField(nil, layerKeys, []byte("naam"))),
+		"other field":        appendBytesField(testTile(testLayer("percelen")), 4, []byte("x")),
+	}
+
+	for name, tile := range tests {
+		if _, err := Filter(tile, map[string]bool{"percelen": true}, nil, 0); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestIsVectorTileRequest(t *testing.T) {
+	tests := []struct {
+		path   string
+		query  string
+		accept string
+		want   bool
+	}{
+		{"/gwc/service/wmts", "format=application/vnd.mapbox-vector-tile", "", true},
+		{"/collections/wegen/tiles/WebMercatorQuad/1/2/3", "f=mvt", "", true},
+		{"/gwc/service/tms/1.0.0/brk:percelen@EPSG:900913@pbf/1/2/3.pbf", "", "", true},
+		{"/tiles/1/2/3", "", "application/x-protobuf", true},
+		{"/gwc/service/wmts", "format=image/png", "image/png,*/*", false},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		if got := IsVectorTileRequest(test.path, query, test.accept); got != test.want {
+			t.Errorf("IsVectorTileRequest(%q, %q, %q) = %v, want %v", test.path, test.query, test.accept, got, test.want)
+		}
+	}
+}
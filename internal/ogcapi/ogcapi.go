@@ -0,0 +1,119 @@
+package ogcapi
+
+import (
+	"strings"
+)
+
+// Request is an OGC API - Features request, described by the kind of resource
+// it requests and the collection and feature it refers to.
+type Request struct {
+	// Kind is landing, conformance, api, collections, collection, items or
+	// item, or the last path segment for other resources of a collection, such
+	// as queryables.
+	Kind       string
+	Collection string
+	FeatureID  string
+}
+
+// ParsePath returns the request for an OGC API - Features path, such as
+// /collections/{collectionId}/items/{featureId}. Any prefix before the
+// collections segment is ignored.
+func ParsePath(path string) Request {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range segments {
+		if segment != "collections" {
+			continue
+		}
+
+		rest := segments[i+1:]
+		switch {
+		case len(rest) == 0 || rest[0] == "":
+			return Request{Kind: "collections"}
+		case len(rest) == 1:
+			return Request{Kind: "collection", Collection: rest[0]}
+		case len(rest) == 2 && rest[1] == "items":
+			return Request{Kind: "items", Collection: rest[0]}
+		case len(rest) == 3 && rest[1] == "items":
+			return Request{Kind: "item", Collection: rest[0], FeatureID: rest[2]}
+		default:
+			return Request{Kind: rest[len(rest)-1], Collection: rest[0]}
+		}
+	}
+
+	switch last := segments[len(segments)-1]; last {
+	case "conformance", "api":
+		return Request{Kind: last}
+	default:
+		return Request{Kind: "landing"}
+	}
+}
+
+// HasFeatures reports whether the response to the request contains features.
+func (r Request) HasFeatures() bool {
+	return r.Kind == "items" || r.Kind == "item"
+}
+
+// FilterCollections removes the collections that are not allowed by resources
+// from a /collections document. A nil map allows no collections at all, so an
+// authorization service that does not decide per collection can not expose
+// them by accident.
+func FilterCollections(document map[string]interface{}, resources map[string]bool) {
+	collections, ok := document["collections"].([]interface{})
+	if !ok {
+		return
+	}
+
+	allowed := []interface{}{}
+	for _, c := range collections {
+		collection, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if id, _ := collection["id"].(string); resources[id] {
+			allowed = append(allowed, collection)
+		}
+	}
+
+	document["collections"] = allowed
+}
+
+// RewriteLinks replaces the prefix from with to in every href in the document,
+// so that links to the backend point to the proxy instead.
+func RewriteLinks(document interface{}, from string, to string) {
+	switch value := document.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if href, ok := child.(string); ok && key == "href" {
+				rest, found := strings.CutPrefix(href, from)
+				if found && (rest == "" || strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, "?")) {
+					value[key] = to + rest
+				}
+				continue
+			}
+
+			RewriteLinks(child, from, to)
+		}
+	case []interface{}:
+		for _, child := range value {
+			RewriteLinks(child, from, to)
+		}
+	}
+}
+
+// Prefixes returns the parts of the proxy path and the backend path that
+// precede the path segments they have in common at their end, which are the
+// prefixes under which the proxy and the backend serve the API.
+func Prefixes(proxyPath string, backendPath string) (string, string) {
+	proxySegments := strings.Split(strings.TrimSuffix(proxyPath, "/"), "/")
+	backendSegments := strings.Split(strings.TrimSuffix(backendPath, "/"), "/")
+
+	for len(proxySegments) > 1 && len(backendSegments) > 1 &&
+		proxySegments[len(proxySegments)-1] == backendSegments[len(backendSegments)-1] {
+		proxySegments = proxySegments[:len(proxySegments)-1]
+		backendSegments = backendSegments[:len(backendSegments)-1]
+	}
+
+	return strings.Join(proxySegments, "/"), strings.Join(backendSegments, "/")
+}
@@ -0,0 +1,83 @@
+package ogcapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := map[string]Request{
+		"/api/features":                          {Kind: "landing"},
+		"/api/features/conformance":              {Kind: "conformance"},
+		"/api/features/collections":              {Kind: "collections"},
+		"/api/features/collections/":             {Kind: "collections"},
+		"/api/features/collections/wegen":        {Kind: "collection", Collection: "wegen"},
+		"/api/features/collections/wegen/items":  {Kind: "items", Collection: "wegen"},
+		"/api/features/collections/wegen/items/": {Kind: "items", Collection: "wegen"},
+		"/collections/wegen/items/wegen.1":       {Kind: "item", Collection: "wegen", FeatureID: "wegen.1"},
+		"/collections/wegen/queryables":          {Kind: "queryables", Collection: "wegen"},
+	}
+
+	for path, want := range tests {
+		if got := ParsePath(path); got != want {
+			t.Errorf("ParsePath(%q) = %+v, want %+v", path, got, want)
+		}
+	}
+}
+
+func TestFilterCollections(t *testing.T) {
+	document := func() map[string]interface{} {
+		return map[string]interface{}{
+			"collections": []interface{}{
+				map[string]interface{}{"id": "wegen"},
+				map[string]interface{}{"id": "percelen"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		resources map[string]bool
+		want      []interface{}
+	}{
+		{"allowed collections", map[string]bool{"wegen": true, "percelen": false}, []interface{}{map[string]interface{}{"id": "wegen"}}},
+		{"no resources", nil, []interface{}{}},
+	}
+
+	for _, test := range tests {
+		filtered := document()
+		FilterCollections(filtered, test.resources)
+		if !reflect.DeepEqual(filtered["collections"], test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, filtered["collections"], test.want)
+		}
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	document := map[string]interface{}{
+		"links": []interface{}{
+			map[string]interface{}{"href": "http://backend/ogc/features/v1/collections?f=json"},
+			map[string]interface{}{"href": "http://backend/ogc/features/v1x"},
+			map[string]interface{}{"href": "https://example.com/"},
+		},
+	}
+
+	RewriteLinks(document, "http://backend/ogc/features/v1", "https://proxy/api/features")
+
+	var got []string
+	for _, link := range document["links"].([]interface{}) {
+		got = append(got, link.(map[string]interface{})["href"].(string))
+	}
+
+	want := []string{"https://proxy/api/features/collections?f=json", "http://backend/ogc/features/v1x", "https://example.com/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	proxy, backend := Prefixes("/api/features/collections/wegen", "/ogc/features/v1/collections/wegen")
+	if proxy != "/api/features" || backend != "/ogc/features/v1" {
+		t.Errorf("got %s and %s", proxy, backend)
+	}
+}
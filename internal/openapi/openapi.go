@@ -0,0 +1,481 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/delta10/filter-proxy/internal/jsonschema"
+)
+
+// methods are the operations of a path item, in the order in which they are
+// listed.
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// captureGroup matches the start of a capturing group in a regular expression,
+// which gorilla/mux does not accept in route templates.
+var captureGroup = regexp.MustCompile(`(^|[^\\])\((?:[^?]|$)`)
+
+// Document is an OpenAPI 3 document.
+type Document struct {
+	raw map[string]interface{}
+}
+
+// Operation is an operation of an OpenAPI document.
+type Operation struct {
+	ID     string
+	Method string
+	// Path is the path template of the operation, such as
+	// /personen/{burgerservicenummer}.
+	Path       string
+	Parameters []Parameter
+	// Body is the schema of a JSON request body, if any.
+	Body         *jsonschema.Schema
+	BodyRequired bool
+}
+
+// Parameter is a path, query or header parameter of an operation.
+type Parameter struct {
+	Name     string
+	In       string
+	Required bool
+	Explode  bool
+	Schema   *jsonschema.Schema
+
+	// schema is the decoded schema, which describes how values are converted.
+	schema map[string]interface{}
+}
+
+// Load reads an OpenAPI document from a JSON or YAML file.
+func Load(file string) (*Document, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses an OpenAPI document in JSON or YAML.
+func Parse(data []byte) (*Document, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		decoded = normalize(document)
+	}
+
+	raw, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("openapi document is not an object")
+	}
+
+	if version, _ := raw["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q", version)
+	}
+
+	return &Document{raw: raw}, nil
+}
+
+// normalize converts a value decoded from YAML to the types encoding/json
+// decodes to, so that it can be validated and encoded as JSON.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			normalized[fmt.Sprint(key)] = normalize(child)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, child := range v {
+			normalized[i] = normalize(child)
+		}
+		return normalized
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// Operations returns the operations of the document, ordered by path and
+// method.
+func (d *Document) Operations() ([]Operation, error) {
+	paths, _ := d.raw["paths"].(map[string]interface{})
+
+	templates := make([]string, 0, len(paths))
+	for template := range paths {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+
+	var operations []Operation
+	for _, template := range templates {
+		item, _ := d.resolveObject(paths[template])
+		if item == nil {
+			continue
+		}
+
+		for _, method := range methods {
+			raw, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			operation, err := d.operation(template, method, item, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), template, err)
+			}
+
+			operations = append(operations, operation)
+		}
+	}
+
+	return operations, nil
+}
+
+func (d *Document) operation(template string, method string, item map[string]interface{}, raw map[string]interface{}) (Operation, error) {
+	operation := Operation{Method: strings.ToUpper(method), Path: template}
+	operation.ID, _ = raw["operationId"].(string)
+
+	// Parameters of the operation override those of the path item with the
+	// same name and location.
+	parameters := map[string]Parameter{}
+	var order []string
+	for _, list := range []interface{}{item["parameters"], raw["parameters"]} {
+		list, _ := list.([]interface{})
+		for _, value := range list {
+			parameter, err := d.parameter(value)
+			if err != nil {
+				return operation, err
+			}
+
+			key := parameter.In + ":" + parameter.Name
+			if _, ok := parameters[key]; !ok {
+				order = append(order, key)
+			}
+			parameters[key] = parameter
+		}
+	}
+
+	for _, key := range order {
+		operation.Parameters = append(operation.Parameters, parameters[key])
+	}
+
+	if body, ok := d.resolveObject(raw["requestBody"]); ok {
+		operation.BodyRequired, _ = body["required"].(bool)
+
+		content, _ := body["content"].(map[string]interface{})
+		for mediaType, value := range content {
+			if !strings.Contains(mediaType, "json") {
+				continue
+			}
+
+			media, _ := value.(map[string]interface{})
+			if schema, ok := media["schema"]; ok {
+				compiled, err := jsonschema.NewIn(d.raw, schema)
+				if err != nil {
+					return operation, err
+				}
+				operation.Body = compiled
+			}
+			break
+		}
+	}
+
+	return operation, nil
+}
+
+func (d *Document) parameter(value interface{}) (Parameter, error) {
+	raw, ok := d.resolveObject(value)
+	if !ok {
+		return Parameter{}, fmt.Errorf("invalid parameter")
+	}
+
+	parameter := Parameter{}
+	parameter.Name, _ = raw["name"].(string)
+	parameter.In, _ = raw["in"].(string)
+	parameter.Required, _ = raw["required"].(bool)
+
+	// Query parameters are exploded by default, the others are not.
+	parameter.Explode = parameter.In == "query"
+	if explode, ok := raw["explode"].(bool); ok {
+		parameter.Explode = explode
+	}
+
+	if schema, ok := raw["schema"]; ok {
+		compiled, err := jsonschema.NewIn(d.raw, schema)
+		if err != nil {
+			return parameter, fmt.Errorf("parameter %s: %w", parameter.Name, err)
+		}
+
+		parameter.Schema = compiled
+		parameter.schema, _ = d.resolveObject(schema)
+	}
+
+	return parameter, nil
+}
+
+// resolveObject returns an object, following its reference when it is a
+// reference object.
+func (d *Document) resolveObject(value interface{}) (map[string]interface{}, bool) {
+	for i := 0; i < 32; i++ {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return object, true
+		}
+
+		value = d.pointer(ref)
+	}
+
+	return nil, false
+}
+
+func (d *Document) pointer(ref string) interface{} {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+
+	var current interface{} = d.raw
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[token]
+	}
+
+	return current
+}
+
+// Template returns the path of the operation as a gorilla/mux route template,
+// in which path parameters are restricted to the values their schemas allow
+// where that can be expressed as a regular expression.
+func (o Operation) Template() string {
+	template := o.Path
+	for _, parameter := range o.Parameters {
+		if parameter.In != "path" {
+			continue
+		}
+
+		if pattern := parameter.pattern(); pattern != "" {
+			template = strings.ReplaceAll(template, "{"+parameter.Name+"}", "{"+parameter.Name+":"+pattern+"}")
+		}
+	}
+
+	return template
+}
+
+func (p Parameter) pattern() string {
+	switch p.schema["type"] {
+	case "integer":
+		return "[0-9]+"
+	case "string":
+		pattern, _ := p.schema["pattern"].(string)
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+		if pattern == "" || strings.Contains(pattern, "/") || captureGroup.MatchString(pattern) {
+			return ""
+		}
+		return pattern
+	default:
+		return ""
+	}
+}
+
+// Validate returns the violations of the parameters and body of a request to
+// the operation. The paths of the violations are the locations of the
+// parameters, such as query/fields, or body followed by the pointer into the
+// body. Query parameters that the operation does not declare, and repeated
+// parameters other than exploded query arrays, are violations as well.
+func (o Operation) Validate(vars map[string]string, query url.Values, header http.Header, body []byte) []jsonschema.Violation {
+	var violations []jsonschema.Violation
+
+	declared := map[string]bool{}
+	for _, parameter := range o.Parameters {
+		if parameter.In == "query" {
+			declared[parameter.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !declared[name] {
+			violations = append(violations, jsonschema.Violation{Path: "query/" + name, Message: "unknown parameter"})
+		}
+	}
+
+	for _, parameter := range o.Parameters {
+		var values []string
+		switch parameter.In {
+		case "path":
+			if value, ok := vars[parameter.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[parameter.Name]
+		case "header":
+			values = header.Values(parameter.Name)
+		default:
+			continue
+		}
+
+		location := parameter.In + "/" + parameter.Name
+		if len(values) == 0 {
+			if parameter.Required {
+				violations = append(violations, jsonschema.Violation{Path: location, Message: "missing required parameter"})
+			}
+			continue
+		}
+
+		if len(values) > 1 && !parameter.repeatable() {
+			violations = append(violations, jsonschema.Violation{Path: location, Message: "parameter must not be repeated"})
+			continue
+		}
+
+		if parameter.Schema == nil {
+			continue
+		}
+
+		for _, violation := range parameter.Schema.Validate(parameter.convert(values)) {
+			violation.Path = location + violation.Path
+			violations = append(violations, violation)
+		}
+	}
+
+	if len(strings.TrimSpace(string(body))) == 0 {
+		if o.BodyRequired {
+			violations = append(violations, jsonschema.Violation{Path: "body", Message: "missing required request body"})
+		}
+		return violations
+	}
+
+	if o.Body != nil {
+		var document interface{}
+		if err := json.Unmarshal(body, &document); err != nil {
+			return append(violations, jsonschema.Violation{Path: "body", Message: "request body is not valid json"})
+		}
+
+		for _, violation := range o.Body.Validate(document) {
+			violation.Path = "body" + violation.Path
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations
+}
+
+// repeatable reports whether a parameter may be given more than once, which is
+// only the case for an exploded query parameter of which the schema is an
+// array.
+func (p Parameter) repeatable() bool {
+	return p.In == "query" && p.Explode && p.schema["type"] == "array"
+}
+
+// convert converts the values of a parameter to the type of its schema, so
+// that they can be validated. Values that can not be converted are kept as
+// strings, which results in a type violation. Only exploded parameters are
+// given by more than one value.
+func (p Parameter) convert(values []string) interface{} {
+	if p.schema["type"] != "array" {
+		return convertValue(values[0], p.schema)
+	}
+
+	if !p.Explode {
+		values = strings.Split(values[0], ",")
+	}
+
+	items, _ := p.schema["items"].(map[string]interface{})
+	converted := make([]interface{}, len(values))
+	for i, value := range values {
+		converted[i] = convertValue(value, items)
+	}
+
+	return converted
+}
+
+func convertValue(value string, schema map[string]interface{}) interface{} {
+	switch schema["type"] {
+	case "integer", "number":
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	case "boolean":
+		if boolean, err := strconv.ParseBool(value); err == nil {
+			return boolean
+		}
+	}
+
+	return value
+}
+
+// Filter returns the document with only the operations given, of which the
+// paths are served under prefix by the proxy.
+func (d *Document) Filter(operations []Operation, prefix string) map[string]interface{} {
+	filtered := make(map[string]interface{}, len(d.raw))
+	for key, value := range d.raw {
+		filtered[key] = value
+	}
+
+	filtered["servers"] = []interface{}{map[string]interface{}{"url": prefix}}
+
+	source, _ := d.raw["paths"].(map[string]interface{})
+	paths := map[string]interface{}{}
+	for _, operation := range operations {
+		item, _ := d.resolveObject(source[operation.Path])
+
+		exposed, ok := paths[operation.Path].(map[string]interface{})
+		if !ok {
+			exposed = map[string]interface{}{}
+			for key, value := range item {
+				if !isMethod(key) {
+					exposed[key] = value
+				}
+			}
+			paths[operation.Path] = exposed
+		}
+
+		exposed[strings.ToLower(operation.Method)] = item[strings.ToLower(operation.Method)]
+	}
+	filtered["paths"] = paths
+
+	return filtered
+}
+
+func isMethod(key string) bool {
+	for _, method := range methods {
+		if key == method {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,182 @@
+package openapi
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const document = `
+openapi: 3.0.3
+info:
+  title: BRK
+  version: "1"
+paths:
+  /kadastraalonroerendezaken/{kadastraalOnroerendeZaakIdentificatie}:
+    parameters:
+      - $ref: "#/components/parameters/identificatie"
+    get:
+      operationId: GetKadastraalOnroerendeZaak
+      parameters:
+        - name: fields
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+        - name: expand
+          in: query
+          explode: false
+          schema:
+            type: array
+            items:
+              type: string
+        - name: pageSize
+          in: query
+          schema:
+            type: integer
+            maximum: 100
+        - name: Accept-Crs
+          in: header
+          required: true
+          schema:
+            type: string
+            enum: [epsg:28992]
+    delete:
+      operationId: DeleteKadastraalOnroerendeZaak
+  /zakelijkgerechtigden:
+    post:
+      operationId: ZoekZakelijkGerechtigden
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [type]
+              properties:
+                type:
+                  type: string
+components:
+  parameters:
+    identificatie:
+      name: kadastraalOnroerendeZaakIdentificatie
+      in: path
+      required: true
+      schema:
+        type: string
+        pattern: "^[0-9]{15}$"
+`
+
+func operations(t *testing.T) map[string]Operation {
+	t.Helper()
+
+	parsed, err := Parse([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := parsed.Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID := map[string]Operation{}
+	for _, operation := range list {
+		byID[operation.ID] = operation
+	}
+
+	return byID
+}
+
+func TestOperations(t *testing.T) {
+	byID := operations(t)
+
+	get := byID["GetKadastraalOnroerendeZaak"]
+	if get.Method != "GET" || len(get.Parameters) != 5 {
+		t.Fatalf("GetKadastraalOnroerendeZaak = %s with %d parameters, want GET with 5", get.Method, len(get.Parameters))
+	}
+
+	if template := get.Template(); template != "/kadastraalonroerendezaken/{kadastraalOnroerendeZaakIdentificatie:[0-9]{15}}" {
+		t.Errorf("Template() = %s", template)
+	}
+
+	if _, ok := byID["DeleteKadastraalOnroerendeZaak"]; !ok {
+		t.Error("Operations() is missing DeleteKadastraalOnroerendeZaak")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	byID := operations(t)
+	vars := map[string]string{"kadastraalOnroerendeZaakIdentificatie": "123456789012345"}
+	header := http.Header{"Accept-Crs": {"epsg:28992"}}
+
+	tests := []struct {
+		name      string
+		operation string
+		query     string
+		header    http.Header
+		body      string
+		want      []string
+	}{
+		{"valid", "GetKadastraalOnroerendeZaak", "fields=a&fields=b&expand=c,d&pageSize=10", header, "", nil},
+		{"unknown query parameter", "GetKadastraalOnroerendeZaak", "pageSize=10&debug=true", header, "", []string{"query/debug"}},
+		{"repeated parameter", "GetKadastraalOnroerendeZaak", "pageSize=10&pageSize=1000", header, "", []string{"query/pageSize"}},
+		{"repeated unexploded array", "GetKadastraalOnroerendeZaak", "expand=a&expand=b", header, "", []string{"query/expand"}},
+		{"invalid value", "GetKadastraalOnroerendeZaak", "pageSize=1000", header, "", []string{"query/pageSize"}},
+		{"not a number", "GetKadastraalOnroerendeZaak", "pageSize=tien", header, "", []string{"query/pageSize"}},
+		{"missing header", "GetKadastraalOnroerendeZaak", "", http.Header{}, "", []string{"header/Accept-Crs"}},
+		{"repeated header", "GetKadastraalOnroerendeZaak", "", http.Header{"Accept-Crs": {"epsg:28992", "epsg:4326"}}, "", []string{"header/Accept-Crs"}},
+		{"valid body", "ZoekZakelijkGerechtigden", "", nil, `{"type": "eigendom"}`, nil},
+		{"missing body", "ZoekZakelijkGerechtigden", "", nil, "", []string{"body"}},
+		{"invalid body", "ZoekZakelijkGerechtigden", "", nil, `{"type": 1}`, []string{"body/type"}},
+		{"malformed body", "ZoekZakelijkGerechtigden", "", nil, `{`, []string{"body"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var paths []string
+			for _, violation := range byID[test.operation].Validate(vars, query, test.header, []byte(test.body)) {
+				paths = append(paths, violation.Path)
+			}
+
+			if !reflect.DeepEqual(paths, test.want) {
+				t.Errorf("Validate() violations at %v, want %v", paths, test.want)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	parsed, err := Parse([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID := operations(t)
+	filtered := parsed.Filter([]Operation{byID["GetKadastraalOnroerendeZaak"]}, "/api/brk/v1")
+
+	paths := filtered["paths"].(map[string]interface{})
+	if len(paths) != 1 {
+		t.Fatalf("Filter() kept %d paths, want 1", len(paths))
+	}
+
+	item := paths["/kadastraalonroerendezaken/{kadastraalOnroerendeZaakIdentificatie}"].(map[string]interface{})
+	if _, ok := item["delete"]; ok {
+		t.Error("Filter() kept the delete operation")
+	}
+	if _, ok := item["parameters"]; !ok {
+		t.Error("Filter() dropped the parameters of the path item")
+	}
+
+	servers := filtered["servers"].([]interface{})
+	if servers[0].(map[string]interface{})["url"] != "/api/brk/v1" {
+		t.Errorf("servers = %v, want the prefix of the proxy", servers)
+	}
+}
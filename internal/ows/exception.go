@@ -0,0 +1,220 @@
+package ows
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	Namespace    = "http://www.opengis.net/ows"
+	Namespace11  = "http://www.opengis.net/ows/1.1"
+	ogcNamespace = "http://www.opengis.net/ogc"
+)
+
+// statusCodes maps OWS Common and WFS exception codes to HTTP status codes, as
+// listed in OWS Common 1.1 and WFS 2.0.
+var statusCodes = map[string]int{
+	"OperationNotSupported":             http.StatusNotImplemented,
+	"OptionNotSupported":                http.StatusNotImplemented,
+	"MissingParameterValue":             http.StatusBadRequest,
+	"InvalidParameterValue":             http.StatusBadRequest,
+	"VersionNegotiationFailed":          http.StatusBadRequest,
+	"InvalidUpdateSequence":             http.StatusBadRequest,
+	"NoApplicableCode":                  http.StatusInternalServerError,
+	"CannotLockAllFeatures":             http.StatusBadRequest,
+	"DuplicateStoredQueryIdValue":       http.StatusBadRequest,
+	"DuplicateStoredQueryParameterName": http.StatusBadRequest,
+	"FeaturesNotLocked":                 http.StatusBadRequest,
+	"InvalidLockId":                     http.StatusBadRequest,
+	"InvalidValue":                      http.StatusBadRequest,
+	"LockHasExpired":                    http.StatusBadRequest,
+	"OperationParsingFailed":            http.StatusBadRequest,
+	"OperationProcessingFailed":         http.StatusInternalServerError,
+	"ResponseCacheExpired":              http.StatusBadRequest,
+	"InvalidFormat":                     http.StatusBadRequest,
+	"LayerNotDefined":                   http.StatusNotFound,
+	"StyleNotDefined":                   http.StatusBadRequest,
+	"InvalidSRS":                        http.StatusBadRequest,
+	"InvalidCRS":                        http.StatusBadRequest,
+	"TileOutOfRange":                    http.StatusBadRequest,
+	"LayerNotQueryable":                 http.StatusBadRequest,
+	"InvalidPoint":                      http.StatusBadRequest,
+}
+
+// Exception is a single exception of an exception report.
+type Exception struct {
+	Code    string   `json:"code"`
+	Locator string   `json:"locator,omitempty"`
+	Text    []string `json:"text,omitempty"`
+}
+
+// ExceptionReport is an OWS Common ExceptionReport or a WMS or WFS 1.0.0
+// ServiceExceptionReport.
+type ExceptionReport struct {
+	Exceptions []Exception `json:"exceptions"`
+}
+
+// ParseExceptionReport parses an OWS Common ExceptionReport of any version or a
+// ServiceExceptionReport.
+func ParseExceptionReport(body []byte) (*ExceptionReport, error) {
+	var document struct {
+		XMLName    xml.Name
+		Exceptions []struct {
+			XMLName       xml.Name
+			ExceptionCode string   `xml:"exceptionCode,attr"`
+			Code          string   `xml:"code,attr"`
+			Locator       string   `xml:"locator,attr"`
+			Texts         []string `xml:"ExceptionText"`
+			Text          string   `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := xml.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	if document.XMLName.Local != "ExceptionReport" && document.XMLName.Local != "ServiceExceptionReport" {
+		return nil, fmt.Errorf("unexpected exception report: %s", document.XMLName.Local)
+	}
+
+	report := &ExceptionReport{}
+	for _, e := range document.Exceptions {
+		if e.XMLName.Local != "Exception" && e.XMLName.Local != "ServiceException" {
+			continue
+		}
+
+		exception := Exception{Code: e.ExceptionCode, Locator: e.Locator}
+		if exception.Code == "" {
+			exception.Code = e.Code
+		}
+
+		for _, text := range append(e.Texts, e.Text) {
+			if text = strings.TrimSpace(text); text != "" {
+				exception.Text = append(exception.Text, text)
+			}
+		}
+
+		report.Exceptions = append(report.Exceptions, exception)
+	}
+
+	return report, nil
+}
+
+// StatusCode returns the HTTP status code for an exception code. Unknown codes
+// are treated as NoApplicableCode.
+func StatusCode(code string) int {
+	if statusCode, ok := statusCodes[code]; ok {
+		return statusCode
+	}
+
+	return http.StatusInternalServerError
+}
+
+// StatusCode returns the HTTP status code of the first exception.
+func (r ExceptionReport) StatusCode() int {
+	if len(r.Exceptions) == 0 {
+		return http.StatusInternalServerError
+	}
+
+	return StatusCode(r.Exceptions[0].Code)
+}
+
+// Message returns the texts of all exceptions.
+func (r ExceptionReport) Message() string {
+	var texts []string
+	for _, exception := range r.Exceptions {
+		texts = append(texts, exception.Text...)
+	}
+
+	return strings.Join(texts, "; ")
+}
+
+// WFS encodes the report as the exception document of a WFS version: a
+// ServiceExceptionReport for 1.0.0, an OWS 1.0 ExceptionReport for 1.1.0 and
+// an OWS 1.1 ExceptionReport for 2.0.
+func (r ExceptionReport) WFS(version string) []byte {
+	var document bytes.Buffer
+	document.WriteString(xml.Header)
+
+	switch {
+	case version == "1.0.0":
+		r.writeServiceExceptionReport(&document, ogcNamespace, "1.2.0")
+	case strings.HasPrefix(version, "2."):
+		r.writeExceptionReport(&document, Namespace11, "2.0.0")
+	default:
+		r.writeExceptionReport(&document, Namespace, "1.0.0")
+	}
+
+	return document.Bytes()
+}
+
+// WMS encodes the report as the ServiceExceptionReport of a WMS version, which
+// is only namespaced from WMS 1.3.0 on.
+func (r ExceptionReport) WMS(version string) []byte {
+	var document bytes.Buffer
+	document.WriteString(xml.Header)
+
+	switch version {
+	case "1.0.0", "1.1.0", "1.1.1":
+		fmt.Fprintf(&document, `<!DOCTYPE ServiceExceptionReport SYSTEM "http://schemas.opengis.net/wms/1.1.1/WMS_exception_1_1_1.dtd">`)
+		r.writeServiceExceptionReport(&document, "", "1.1.1")
+	default:
+		r.writeServiceExceptionReport(&document, ogcNamespace, "1.3.0")
+	}
+
+	return document.Bytes()
+}
+
+// OWS encodes the report as an OWS 1.1 ExceptionReport, as used by WMTS.
+func (r ExceptionReport) OWS(version string) []byte {
+	var document bytes.Buffer
+	document.WriteString(xml.Header)
+	r.writeExceptionReport(&document, Namespace11, version)
+
+	return document.Bytes()
+}
+
+func (r ExceptionReport) writeExceptionReport(document *bytes.Buffer, namespace string, version string) {
+	fmt.Fprintf(document, `<ows:ExceptionReport xmlns:ows="%s" version="%s">`, namespace, version)
+	for _, exception := range r.Exceptions {
+		fmt.Fprintf(document, `<ows:Exception exceptionCode="%s"`, escape(exception.Code))
+		if exception.Locator != "" {
+			fmt.Fprintf(document, ` locator="%s"`, escape(exception.Locator))
+		}
+		document.WriteString(">")
+
+		for _, text := range exception.Text {
+			fmt.Fprintf(document, "<ows:ExceptionText>%s</ows:ExceptionText>", escape(text))
+		}
+		document.WriteString("</ows:Exception>")
+	}
+	document.WriteString("</ows:ExceptionReport>")
+}
+
+func (r ExceptionReport) writeServiceExceptionReport(document *bytes.Buffer, namespace string, version string) {
+	document.WriteString("<ServiceExceptionReport")
+	if namespace != "" {
+		fmt.Fprintf(document, ` xmlns="%s"`, namespace)
+	}
+	fmt.Fprintf(document, ` version="%s">`, version)
+
+	for _, exception := range r.Exceptions {
+		document.WriteString("<ServiceException")
+		if exception.Code != "" {
+			fmt.Fprintf(document, ` code="%s"`, escape(exception.Code))
+		}
+		if exception.Locator != "" {
+			fmt.Fprintf(document, ` locator="%s"`, escape(exception.Locator))
+		}
+		fmt.Fprintf(document, ">%s</ServiceException>", escape(strings.Join(exception.Text, "\n")))
+	}
+	document.WriteString("</ServiceExceptionReport>")
+}
+
+func escape(value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
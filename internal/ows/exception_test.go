@@ -0,0 +1,72 @@
+package ows
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseExceptionReport(t *testing.T) {
+	report, err := ParseExceptionReport([]byte(`<ows:ExceptionReport xmlns:ows="http://www.opengis.net/ows/1.1" version="2.0.0">` +
+		`<ows:Exception exceptionCode="InvalidParameterValue" locator="typeName"><ows:ExceptionText>unknown type</ows:ExceptionText></ows:Exception>` +
+		`</ows:ExceptionReport>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.StatusCode() != 400 || report.Message() != "unknown type" || report.Exceptions[0].Locator != "typeName" {
+		t.Errorf("got %+v", report)
+	}
+
+	report, err = ParseExceptionReport([]byte(`<ServiceExceptionReport version="1.1.1"><ServiceException code="LayerNotDefined">no layer</ServiceException></ServiceExceptionReport>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.StatusCode() != 404 || report.Message() != "no layer" {
+		t.Errorf("got %+v", report)
+	}
+
+	if _, err := ParseExceptionReport([]byte(`<FeatureCollection/>`)); err == nil {
+		t.Error("expected an error for a feature collection")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	report := ExceptionReport{Exceptions: []Exception{{Code: "NoApplicableCode", Text: []string{"a < b"}}}}
+
+	tests := []struct {
+		name        string
+		query       string
+		body        string
+		contentType string
+		contains    string
+	}{
+		{"wms 1.1.1", "SERVICE=WMS&VERSION=1.1.1", "", "application/vnd.ogc.se_xml", "<ServiceExceptionReport version=\"1.1.1\">"},
+		{"wms 1.3.0", "service=wms&version=1.3.0", "", "text/xml", `xmlns="http://www.opengis.net/ogc" version="1.3.0"`},
+		{"wfs 2.0 body", "", `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs/2.0" version="2.0.0"/>`, "text/xml", `xmlns:ows="http://www.opengis.net/ows/1.1" version="2.0.0"`},
+		{"wfs 1.0.0", "service=WFS&version=1.0.0", "", "text/xml", `version="1.2.0"`},
+		{"json", "service=WFS&exceptions=application/json", "", "application/json", `"message":"a \u003c b"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(test.query)
+			recorder := httptest.NewRecorder()
+			RequestExceptions("OWS", query, []byte(test.body)).Write(recorder, 401, report)
+
+			if recorder.Code != 401 || recorder.Header().Get("Content-Type") != test.contentType {
+				t.Fatalf("got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+			}
+
+			if !strings.Contains(recorder.Body.String(), test.contains) {
+				t.Errorf("%s does not contain %s", recorder.Body.String(), test.contains)
+			}
+
+			if test.contentType != "application/json" && !strings.Contains(recorder.Body.String(), "a &lt; b") {
+				t.Errorf("%s does not contain the escaped message", recorder.Body.String())
+			}
+		})
+	}
+}
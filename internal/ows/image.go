@@ -0,0 +1,141 @@
+package ows
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	defaultImageSize = 256
+	// maxImageSize limits the size of the images that are rendered for
+	// requests that have not been authorized yet.
+	maxImageSize = 512
+
+	imageMargin  = 4
+	unknownGlyph = '?'
+)
+
+// face is the font in which messages are drawn.
+var face = basicfont.Face7x13
+
+// renderImage renders message in an image of the size and format of a WMS
+// GetMap request. An empty message results in a blank image.
+func renderImage(e Exceptions, message string) (string, []byte, error) {
+	width, height := imageSize(e.Width), imageSize(e.Height)
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	format := strings.ToLower(e.ImageFormat)
+	opaque := !e.Transparent || strings.Contains(format, "jpeg")
+
+	background := color.RGBA{255, 255, 255, 255}
+	if value, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(e.Background), "0x"), 16, 32); err == nil && e.Background != "" {
+		background = color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}
+	}
+
+	if opaque {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				canvas.SetRGBA(x, y, background)
+			}
+		}
+	}
+
+	drawText(canvas, message)
+
+	var encoded bytes.Buffer
+	var err error
+	switch {
+	case strings.Contains(format, "jpeg"):
+		err = jpeg.Encode(&encoded, canvas, nil)
+		format = "image/jpeg"
+	case strings.Contains(format, "gif"):
+		err = gif.Encode(&encoded, canvas, nil)
+		format = "image/gif"
+	default:
+		err = png.Encode(&encoded, canvas)
+		format = "image/png"
+	}
+
+	return format, encoded.Bytes(), err
+}
+
+func imageSize(size int) int {
+	if size <= 0 {
+		return defaultImageSize
+	}
+
+	return min(size, maxImageSize)
+}
+
+// drawText draws text in black, wrapping it at word boundaries to fit the
+// width of the image. Text that does not fit the height is cut off.
+func drawText(canvas *image.RGBA, text string) {
+	bounds := canvas.Bounds()
+	columns := max((bounds.Dx()-2*imageMargin)/face.Advance, 1)
+
+	drawer := font.Drawer{Dst: canvas, Src: image.Black, Face: face}
+	y := imageMargin
+	for _, line := range wrapText(text, columns) {
+		if y+face.Height > bounds.Dy() {
+			return
+		}
+
+		drawer.Dot = fixed.P(imageMargin, y+face.Ascent)
+		drawer.DrawString(strings.Map(printable, line))
+
+		y += face.Height
+	}
+}
+
+// wrapText splits text into lines of at most columns characters, breaking
+// lines at spaces and words that are longer than a line within the word.
+func wrapText(text string, columns int) []string {
+	var lines []string
+	var line []rune
+	for _, field := range strings.Fields(text) {
+		word := []rune(field)
+		for len(word) > columns {
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+				line = nil
+			}
+			lines = append(lines, string(word[:columns]))
+			word = word[columns:]
+		}
+
+		switch {
+		case len(line) == 0:
+			line = word
+		case len(line)+1+len(word) <= columns:
+			line = append(append(line, ' '), word...)
+		default:
+			lines = append(lines, string(line))
+			line = word
+		}
+	}
+
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+
+	return lines
+}
+
+// printable replaces characters that are not in the font.
+func printable(char rune) rune {
+	if _, ok := face.GlyphAdvance(char); !ok {
+		return unknownGlyph
+	}
+
+	return char
+}
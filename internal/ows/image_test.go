@@ -0,0 +1,69 @@
+package ows
+
+import (
+	"bytes"
+	"image"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text    string
+		columns int
+		want    []string
+	}{
+		{"layer is not authorized", 10, []string{"layer is", "not", "authorized"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"perceel één", 7, []string{"perceel", "één"}},
+		{"ééééé", 2, []string{"éé", "éé", "é"}},
+	}
+
+	for _, test := range tests {
+		got := wrapText(test.text, test.columns)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrapText(%q, %d) = %q, want %q", test.text, test.columns, got, test.want)
+		}
+
+		for _, line := range got {
+			if !utf8.ValidString(line) {
+				t.Errorf("wrapText(%q, %d) splits a character: %q", test.text, test.columns, line)
+			}
+		}
+	}
+}
+
+func TestWriteImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		exceptions    Exceptions
+		width, height int
+		contentType   string
+	}{
+		{"default size", Exceptions{Service: "WMS", Format: "inimage"}, defaultImageSize, defaultImageSize, "image/png"},
+		{"requested size", Exceptions{Service: "WMS", Format: "inimage", Width: 300, Height: 200, ImageFormat: "image/jpeg"}, 300, 200, "image/jpeg"},
+		{"capped size", Exceptions{Service: "WMS", Format: "blank", Width: 100000, Height: 100000, ImageFormat: "image/gif"}, maxImageSize, maxImageSize, "image/gif"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			test.exceptions.Write(recorder, 401, ExceptionReport{Exceptions: []Exception{{Code: "NoApplicableCode", Text: []string{"laag is niet geautoriseerd ✓"}}}})
+
+			if recorder.Code != 200 || recorder.Header().Get("Content-Type") != test.contentType {
+				t.Fatalf("got %d %s, want 200 %s", recorder.Code, recorder.Header().Get("Content-Type"), test.contentType)
+			}
+
+			config, _, err := image.DecodeConfig(bytes.NewReader(recorder.Body.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if config.Width != test.width || config.Height != test.height {
+				t.Errorf("got %dx%d, want %dx%d", config.Width, config.Height, test.width, test.height)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package ows
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Exceptions describes how exceptions have to be reported to the client of a
+// request: in the format of the service and version it requested, or as an
+// image for a WMS request with an image exception format.
+type Exceptions struct {
+	Service     string
+	Version     string
+	Format      string
+	ImageFormat string
+	Width       int
+	Height      int
+	Transparent bool
+	Background  string
+}
+
+// RequestExceptions returns how exceptions are reported for a request to an
+// OWS or WMTS backend. The service and version are taken from the query
+// parameters or, for XML requests, from the root element of the body.
+func RequestExceptions(backendType string, query url.Values, body []byte) Exceptions {
+	params := url.Values{}
+	for key, values := range query {
+		params[strings.ToLower(key)] = values
+	}
+
+	exceptions := Exceptions{
+		Service:     strings.ToUpper(params.Get("service")),
+		Version:     params.Get("version"),
+		Format:      params.Get("exceptions"),
+		ImageFormat: params.Get("format"),
+		Transparent: strings.EqualFold(params.Get("transparent"), "true"),
+		Background:  params.Get("bgcolor"),
+	}
+	exceptions.Width, _ = strconv.Atoi(params.Get("width"))
+	exceptions.Height, _ = strconv.Atoi(params.Get("height"))
+
+	if exceptions.Version == "" {
+		exceptions.Version = params.Get("wmtver")
+	}
+	if exceptions.Version == "" {
+		exceptions.Version = strings.Split(params.Get("acceptversions"), ",")[0]
+	}
+
+	if exceptions.Service == "" && len(body) > 0 {
+		exceptions.Service, exceptions.Version = bodyServiceVersion(body)
+	}
+
+	if backendType == "WMTS" {
+		exceptions.Service = "WMTS"
+	}
+
+	return exceptions
+}
+
+// bodyServiceVersion returns the service and version of an XML request. The
+// service is derived from the namespace of the root element when it has no
+// service attribute.
+func bodyServiceVersion(body []byte) (string, string) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", ""
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var service, version string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "service":
+				service = strings.ToUpper(attr.Value)
+			case "version":
+				version = attr.Value
+			}
+		}
+
+		if service == "" {
+			for _, name := range []string{"wfs", "wms", "wcs", "wps", "wmts"} {
+				if strings.HasPrefix(start.Name.Space, "http://www.opengis.net/"+name) {
+					service = strings.ToUpper(name)
+				}
+			}
+		}
+
+		return service, version
+	}
+}
+
+// CodeForStatus returns the exception code for an error of the proxy itself.
+func CodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusNotImplemented:
+		return "OperationNotSupported"
+	default:
+		return "NoApplicableCode"
+	}
+}
+
+// Write writes the report in the format requested by the client. Exceptions
+// in an image are written with status 200, as clients otherwise do not show
+// them.
+func (e Exceptions) Write(w http.ResponseWriter, statusCode int, report ExceptionReport) {
+	format := strings.ToLower(e.Format)
+
+	if e.Service == "WMS" {
+		switch format {
+		case "application/vnd.ogc.se_inimage", "inimage":
+			e.writeImage(w, report.Message())
+			return
+		case "application/vnd.ogc.se_blank", "blank":
+			e.writeImage(w, "")
+			return
+		}
+	}
+
+	if format == "application/json" || format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":    report.Message(),
+			"exceptions": report.Exceptions,
+		})
+		return
+	}
+
+	var contentType string
+	var document []byte
+	switch e.Service {
+	case "WMS":
+		contentType, document = "text/xml", report.WMS(e.Version)
+		if e.Version == "1.1.1" || e.Version == "1.1.0" || e.Version == "1.0.0" {
+			contentType = "application/vnd.ogc.se_xml"
+		}
+	case "WFS":
+		contentType, document = "text/xml", report.WFS(e.Version)
+	default:
+		contentType, document = "application/xml", report.OWS("1.0.0")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	w.Write(document)
+}
+
+func (e Exceptions) writeImage(w http.ResponseWriter, message string) {
+	contentType, image, err := renderImage(e, message)
+	if err != nil {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(ExceptionReport{Exceptions: []Exception{{Code: "NoApplicableCode", Text: []string{message}}}}.WMS(e.Version))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(image)
+}
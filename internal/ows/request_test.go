@@ -0,0 +1,67 @@
+package ows
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRequestExceptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		backendType string
+		query       url.Values
+		body        string
+		want        Exceptions
+	}{
+		{
+			"WMS image",
+			"OWS",
+			url.Values{"SERVICE": {"wms"}, "VERSION": {"1.3.0"}, "EXCEPTIONS": {"INIMAGE"}, "FORMAT": {"image/png"}, "WIDTH": {"256"}, "HEIGHT": {"128"}, "TRANSPARENT": {"TRUE"}},
+			"",
+			Exceptions{Service: "WMS", Version: "1.3.0", Format: "INIMAGE", ImageFormat: "image/png", Width: 256, Height: 128, Transparent: true},
+		},
+		{
+			"WMS 1.0",
+			"OWS",
+			url.Values{"service": {"WMS"}, "wmtver": {"1.0.0"}},
+			"",
+			Exceptions{Service: "WMS", Version: "1.0.0"},
+		},
+		{
+			"accepted versions",
+			"OWS",
+			url.Values{"service": {"WFS"}, "acceptversions": {"2.0.0,1.1.0"}},
+			"",
+			Exceptions{Service: "WFS", Version: "2.0.0"},
+		},
+		{
+			"XML request",
+			"OWS",
+			nil,
+			`<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs/2.0" version="2.0.0"/>`,
+			Exceptions{Service: "WFS", Version: "2.0.0"},
+		},
+		{
+			"XML request with a service attribute",
+			"OWS",
+			nil,
+			`<GetCoverage xmlns="urn:other" service="wcs" version="2.0.1"/>`,
+			Exceptions{Service: "WCS", Version: "2.0.1"},
+		},
+		{
+			"WMTS",
+			"WMTS",
+			url.Values{"version": {"1.0.0"}},
+			"",
+			Exceptions{Service: "WMTS", Version: "1.0.0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RequestExceptions(test.backendType, test.query, []byte(test.body)); got != test.want {
+				t.Errorf("RequestExceptions() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
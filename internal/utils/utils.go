@@ -38,6 +38,18 @@ func QueryParamsContainMultipleKeys(queryParams url.Values) bool {
 	return false
 }
 
+// QueryParamKey returns the key under which the parameter name (in lowercase)
+// is stored in queryParams, or an empty string if it is not present.
+func QueryParamKey(queryParams url.Values, name string) string {
+	for key := range queryParams {
+		if strings.ToLower(key) == name {
+			return key
+		}
+	}
+
+	return ""
+}
+
 func GenerateBasicAuthHeader(username, password string) string {
 	auth := username + ":" + password
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
@@ -109,21 +121,40 @@ func StringInSlice(a string, list []string) bool {
 	return false
 }
 
-func GetTransactionMetadata(t wfs.Transaction) (string, int) {
-	var (
-		lastLayerName string
-		count         int
-	)
-
-	if inserts := t.Inserts; len(inserts) == 1 {
-		lastLayerName, count = inserts[0].Layers[0].XMLName.Space+":"+inserts[0].Layers[0].XMLName.Local, count+1
+// TransactionMetadata describes a single action of a WFS transaction: the layer
+// it affects and its operation (insert, update, replace, delete or native).
+type TransactionMetadata = wfs.ActionKey
+
+// GetTransactionMetadata returns the layer and operation of every action in a
+// transaction. Inserts produce an entry for each feature they contain, native
+// actions use their vendor identifier as layer. Layers are named as in the
+// typeName attribute of an update or delete, with the prefix of the namespace
+// of inserted and replaced features. Validate rejects features of which the
+// prefix can not be resolved.
+func GetTransactionMetadata(t wfs.Transaction) []TransactionMetadata {
+	var metadata []TransactionMetadata
+
+	for _, insert := range t.Inserts {
+		for _, layer := range insert.Layers {
+			typeName, _ := t.TypeName(layer, insert.Attrs)
+			metadata = append(metadata, TransactionMetadata{Layer: typeName, Operation: "insert"})
+		}
+	}
+	for _, update := range t.Updates {
+		metadata = append(metadata, TransactionMetadata{Layer: update.TypeName, Operation: "update"})
+	}
+	for _, replace := range t.Replaces {
+		for _, layer := range replace.Layers {
+			typeName, _ := t.TypeName(layer, replace.Attrs)
+			metadata = append(metadata, TransactionMetadata{Layer: typeName, Operation: "replace"})
+		}
 	}
-	if updates := t.Updates; len(updates) == 1 {
-		lastLayerName, count = updates[0].TypeName, count+1
+	for _, deleteAction := range t.Deletes {
+		metadata = append(metadata, TransactionMetadata{Layer: deleteAction.TypeName, Operation: "delete"})
 	}
-	if deletes := t.Deletes; len(deletes) == 1 {
-		lastLayerName, count = deletes[0].TypeName, count+1
+	for _, native := range t.Natives {
+		metadata = append(metadata, TransactionMetadata{Layer: native.VendorID, Operation: "native"})
 	}
 
-	return lastLayerName, count
+	return metadata
 }
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/delta10/filter-proxy/internal/wfs"
+)
+
+func TestGetTransactionMetadata(t *testing.T) {
+	body := `<wfs:Transaction service="WFS" version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:ws="urn:workspace">` +
+		`<wfs:Insert><ws:percelen><ws:naam>a</ws:naam></ws:percelen><gebouwen xmlns="urn:other"><naam>b</naam></gebouwen></wfs:Insert>` +
+		`<wfs:Update typeName="ws:percelen"><wfs:Property><wfs:ValueReference>naam</wfs:ValueReference><wfs:Value>c</wfs:Value></wfs:Property><fes:Filter><fes:ResourceId rid="percelen.1"/></fes:Filter></wfs:Update>` +
+		`<wfs:Replace xmlns:alias="urn:workspace"><alias:wegen><alias:naam>d</alias:naam></alias:wegen><fes:Filter><fes:ResourceId rid="wegen.1"/></fes:Filter></wfs:Replace>` +
+		`<wfs:Delete typeName="ws:wegen"><fes:Filter><fes:ResourceId rid="wegen.2"/></fes:Filter></wfs:Delete>` +
+		`</wfs:Transaction>`
+
+	var transaction wfs.Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := transaction.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TransactionMetadata{
+		{Layer: "ws:percelen", Operation: "insert"},
+		{Layer: "gebouwen", Operation: "insert"},
+		{Layer: "ws:percelen", Operation: "update"},
+		{Layer: "alias:wegen", Operation: "replace"},
+		{Layer: "ws:wegen", Operation: "delete"},
+	}
+
+	if got := GetTransactionMetadata(transaction); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
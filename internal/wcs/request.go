@@ -0,0 +1,56 @@
+package wcs
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+)
+
+// Request is an XML encoded WCS GetCoverage or DescribeCoverage request. The
+// coverages are named by CoverageId in WCS 2.0, by Identifier in WCS 1.1 and by
+// sourceCoverage or Coverage in WCS 1.0.
+type Request struct {
+	XMLName        xml.Name
+	Service        string   `xml:"service,attr"`
+	Version        string   `xml:"version,attr"`
+	CoverageIDs    []string `xml:"CoverageId"`
+	Identifiers    []string `xml:"Identifier"`
+	SourceCoverage string   `xml:"sourceCoverage"`
+	Coverage       []string `xml:"Coverage"`
+}
+
+// Coverages returns the unique coverages named by the request.
+func (r Request) Coverages() []string {
+	names := append(append([]string{}, r.CoverageIDs...), r.Identifiers...)
+	names = append(append(names, r.SourceCoverage), r.Coverage...)
+
+	return unique(names)
+}
+
+// RequestedCoverages returns the unique coverages named by the COVERAGEID,
+// IDENTIFIER(S) and COVERAGE parameters of a (lowercased) WCS query.
+func RequestedCoverages(queryParams url.Values) []string {
+	var names []string
+	for _, key := range []string{"coverageid", "identifier", "identifiers", "coverage"} {
+		names = append(names, strings.Split(queryParams.Get(key), ",")...)
+	}
+
+	return unique(names)
+}
+
+func unique(names []string) []string {
+	var coverages []string
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		coverages = append(coverages, name)
+	}
+
+	return coverages
+}
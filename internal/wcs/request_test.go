@@ -0,0 +1,54 @@
+package wcs
+
+import (
+	"encoding/xml"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestCoverages(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			"WCS 2.0",
+			`<wcs:GetCoverage xmlns:wcs="http://www.opengis.net/wcs/2.0" service="WCS" version="2.0.1"><wcs:CoverageId>ws__ahn</wcs:CoverageId></wcs:GetCoverage>`,
+			[]string{"ws__ahn"},
+		},
+		{
+			"WCS 1.1",
+			`<DescribeCoverage xmlns="http://www.opengis.net/wcs/1.1.1" service="WCS" version="1.1.1"><Identifier>ws:ahn</Identifier><Identifier>ws:bodem</Identifier><Identifier>ws:ahn</Identifier></DescribeCoverage>`,
+			[]string{"ws:ahn", "ws:bodem"},
+		},
+		{
+			"WCS 1.0",
+			`<GetCoverage xmlns="http://www.opengis.net/wcs" service="WCS" version="1.0.0"><sourceCoverage>ws:ahn</sourceCoverage></GetCoverage>`,
+			[]string{"ws:ahn"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request Request
+			if err := xml.Unmarshal([]byte(test.body), &request); err != nil {
+				t.Fatal(err)
+			}
+
+			if coverages := request.Coverages(); !reflect.DeepEqual(coverages, test.want) {
+				t.Errorf("Coverages() = %v, want %v", coverages, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestedCoverages(t *testing.T) {
+	query := url.Values{"coverageid": {"ws__ahn, ws__bodem"}, "identifiers": {"ws__ahn"}}
+
+	want := []string{"ws__ahn", "ws__bodem"}
+	if coverages := RequestedCoverages(query); !reflect.DeepEqual(coverages, want) {
+		t.Errorf("RequestedCoverages() = %v, want %v", coverages, want)
+	}
+}
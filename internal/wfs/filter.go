@@ -0,0 +1,310 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	fesNamespace = "http://www.opengis.net/fes/2.0"
+	gmlNamespace = "http://www.opengis.net/gml"
+)
+
+var (
+	logicalOperators = map[string]bool{
+		"And": true,
+		"Or":  true,
+		"Not": true,
+	}
+	binaryComparisonOperators = map[string]bool{
+		"PropertyIsEqualTo":              true,
+		"PropertyIsNotEqualTo":           true,
+		"PropertyIsLessThan":             true,
+		"PropertyIsGreaterThan":          true,
+		"PropertyIsLessThanOrEqualTo":    true,
+		"PropertyIsGreaterThanOrEqualTo": true,
+		"PropertyIsLike":                 true,
+	}
+	unaryComparisonOperators = map[string]bool{
+		"PropertyIsNull": true,
+		"PropertyIsNil":  true,
+	}
+	spatialOperators = map[string]bool{
+		"BBOX":       true,
+		"Equals":     true,
+		"Disjoint":   true,
+		"Touches":    true,
+		"Within":     true,
+		"Overlaps":   true,
+		"Crosses":    true,
+		"Intersects": true,
+		"Contains":   true,
+		"DWithin":    true,
+		"Beyond":     true,
+	}
+	idOperators = map[string]bool{
+		"FeatureId":   true,
+		"GmlObjectId": true,
+		"ResourceId":  true,
+	}
+	arithmeticOperators = map[string]bool{
+		"Add": true,
+		"Sub": true,
+		"Mul": true,
+		"Div": true,
+	}
+)
+
+// Filter is an OGC Filter Encoding 1.1 or 2.0 filter. Decoding fails for
+// filters that use elements outside of the supported comparison, spatial,
+// logical and identifier operators, so that a filter is never forwarded with
+// parts of it silently dropped.
+type Filter struct {
+	XMLName    xml.Name
+	Attrs      []xml.Attr
+	Predicates []Node
+}
+
+func (f *Filter) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var node Node
+	if err := d.DecodeElement(&node, &start); err != nil {
+		return err
+	}
+
+	if err := validateFilter(node); err != nil {
+		return err
+	}
+
+	f.XMLName = node.XMLName
+	f.Attrs = node.Attrs
+	f.Predicates = node.Nodes
+
+	return nil
+}
+
+func (f Filter) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(Node{XMLName: f.XMLName, Attrs: f.Attrs, Nodes: f.Predicates}, start)
+}
+
+// FeatureIDs returns the identifiers of the features selected by the FeatureId,
+// GmlObjectId and ResourceId predicates of the filter, also when they are
+// combined with other predicates by And or Or, as in a filter that is
+// restricted to an area.
+func (f Filter) FeatureIDs() []string {
+	return featureIDs(f.Predicates)
+}
+
+func featureIDs(predicates []Node) []string {
+	var ids []string
+	for _, predicate := range predicates {
+		switch predicate.XMLName.Local {
+		case "FeatureId":
+			ids = append(ids, predicate.Attr("fid"))
+		case "GmlObjectId":
+			ids = append(ids, predicate.Attr("id"))
+		case "ResourceId":
+			ids = append(ids, predicate.Attr("rid"))
+		case "And", "Or":
+			ids = append(ids, featureIDs(predicate.Nodes)...)
+		}
+	}
+
+	return ids
+}
+
+func validateFilter(filter Node) error {
+	if !isFilterNamespace(filter.XMLName.Space) {
+		return fmt.Errorf("unsupported filter namespace: %q", filter.XMLName.Space)
+	}
+
+	if len(filter.Nodes) == 0 {
+		return fmt.Errorf("filter is empty")
+	}
+
+	if idOperators[filter.Nodes[0].XMLName.Local] {
+		for _, predicate := range filter.Nodes {
+			if err := validateID(predicate); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(filter.Nodes) != 1 {
+		return fmt.Errorf("filter must contain exactly one operator")
+	}
+
+	return validatePredicate(filter.Nodes[0])
+}
+
+func validatePredicate(predicate Node) error {
+	name := predicate.XMLName.Local
+	if !isFilterNamespace(predicate.XMLName.Space) {
+		return fmt.Errorf("unsupported filter element: %s", name)
+	}
+
+	if err := validateText(predicate); err != nil {
+		return err
+	}
+
+	operands := predicate.Nodes
+
+	switch {
+	case logicalOperators[name]:
+		if name == "Not" && len(operands) != 1 {
+			return fmt.Errorf("%s must contain exactly one operator", name)
+		}
+		if name != "Not" && len(operands) < 2 {
+			return fmt.Errorf("%s must contain at least two operators", name)
+		}
+
+		for _, operand := range operands {
+			if err := validatePredicate(operand); err != nil {
+				return err
+			}
+		}
+	case binaryComparisonOperators[name]:
+		if len(operands) != 2 {
+			return fmt.Errorf("%s must contain exactly two expressions", name)
+		}
+
+		return validateExpressions(operands)
+	case unaryComparisonOperators[name]:
+		if len(operands) != 1 {
+			return fmt.Errorf("%s must contain exactly one expression", name)
+		}
+
+		return validateExpressions(operands)
+	case name == "PropertyIsBetween":
+		if len(operands) != 3 || operands[1].XMLName.Local != "LowerBoundary" || operands[2].XMLName.Local != "UpperBoundary" {
+			return fmt.Errorf("%s must contain an expression, a LowerBoundary and an UpperBoundary", name)
+		}
+
+		for _, boundary := range operands[1:] {
+			if len(boundary.Nodes) != 1 {
+				return fmt.Errorf("%s must contain exactly one expression", boundary.XMLName.Local)
+			}
+			if err := validateExpressions(boundary.Nodes); err != nil {
+				return err
+			}
+		}
+
+		return validateExpressions(operands[:1])
+	case spatialOperators[name]:
+		return validateSpatialOperands(name, operands)
+	case idOperators[name]:
+		return validateID(predicate)
+	default:
+		return fmt.Errorf("unsupported filter operator: %s", name)
+	}
+
+	return nil
+}
+
+func validateSpatialOperands(name string, operands []Node) error {
+	expectDistance := name == "DWithin" || name == "Beyond"
+
+	if expectDistance {
+		if len(operands) == 0 || operands[len(operands)-1].XMLName.Local != "Distance" {
+			return fmt.Errorf("%s must contain a Distance", name)
+		}
+
+		distance := operands[len(operands)-1]
+		if len(distance.Nodes) > 0 || (distance.Attr("units") == "" && distance.Attr("uom") == "") {
+			return fmt.Errorf("%s must contain a Distance with units", name)
+		}
+
+		operands = operands[:len(operands)-1]
+	}
+
+	// The property is optional for BBOX, all other operators compare a property
+	// with a geometry or a second expression.
+	minOperands := 2
+	if name == "BBOX" {
+		minOperands = 1
+	}
+
+	if len(operands) < minOperands || len(operands) > 2 {
+		return fmt.Errorf("%s must contain a property and a geometry", name)
+	}
+
+	for _, operand := range operands {
+		if strings.HasPrefix(operand.XMLName.Space, gmlNamespace) {
+			continue
+		}
+
+		if err := validateExpressions([]Node{operand}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateExpressions(expressions []Node) error {
+	for _, expression := range expressions {
+		name := expression.XMLName.Local
+		if !isFilterNamespace(expression.XMLName.Space) {
+			return fmt.Errorf("unsupported expression: %s", name)
+		}
+
+		switch {
+		case name == "PropertyName" || name == "ValueReference":
+			if len(expression.Nodes) > 0 || strings.TrimSpace(expression.Text) == "" {
+				return fmt.Errorf("%s must contain a property name", name)
+			}
+		case name == "Literal":
+			// Literals can contain any content, including GML geometries.
+		case name == "Function":
+			if expression.Attr("name") == "" {
+				return fmt.Errorf("%s must have a name", name)
+			}
+			if err := validateExpressions(expression.Nodes); err != nil {
+				return err
+			}
+		case arithmeticOperators[name]:
+			if len(expression.Nodes) != 2 {
+				return fmt.Errorf("%s must contain exactly two expressions", name)
+			}
+			if err := validateExpressions(expression.Nodes); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported expression: %s", name)
+		}
+	}
+
+	return nil
+}
+
+func validateID(predicate Node) error {
+	name := predicate.XMLName.Local
+	if !isFilterNamespace(predicate.XMLName.Space) || !idOperators[name] {
+		return fmt.Errorf("identifier filters can not be combined with %s", name)
+	}
+
+	if len(predicate.Nodes) > 0 || strings.TrimSpace(predicate.Text) != "" {
+		return fmt.Errorf("%s must be empty", name)
+	}
+
+	attribute := map[string]string{"FeatureId": "fid", "GmlObjectId": "id", "ResourceId": "rid"}[name]
+	if predicate.Attr(attribute) == "" {
+		return fmt.Errorf("%s must have a %s attribute", name, attribute)
+	}
+
+	return nil
+}
+
+func validateText(node Node) error {
+	if len(node.Nodes) > 0 && strings.TrimSpace(node.Text) != "" {
+		return fmt.Errorf("%s contains unexpected text", node.XMLName.Local)
+	}
+
+	return nil
+}
+
+func isFilterNamespace(space string) bool {
+	return space == ogcNamespace || space == fesNamespace
+}
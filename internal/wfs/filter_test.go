@@ -0,0 +1,107 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	ogcFilter = `<ogc:Filter xmlns:ogc="http://www.opengis.net/ogc" xmlns:gml="http://www.opengis.net/gml">%s</ogc:Filter>`
+	fesFilter = `<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:gml="http://www.opengis.net/gml/3.2">%s</fes:Filter>`
+)
+
+func TestFilterValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		body   string
+		err    string
+	}{
+		{"comparison", ogcFilter, `<ogc:PropertyIsEqualTo><ogc:PropertyName>naam</ogc:PropertyName><ogc:Literal>a</ogc:Literal></ogc:PropertyIsEqualTo>`, ""},
+		{"logical", ogcFilter, `<ogc:And><ogc:PropertyIsNull><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsNull><ogc:Not><ogc:PropertyIsLike wildCard="*" singleChar="." escapeChar="!"><ogc:PropertyName>b</ogc:PropertyName><ogc:Literal>x*</ogc:Literal></ogc:PropertyIsLike></ogc:Not></ogc:And>`, ""},
+		{"between", fesFilter, `<fes:PropertyIsBetween><fes:ValueReference>jaar</fes:ValueReference><fes:LowerBoundary><fes:Literal>2000</fes:Literal></fes:LowerBoundary><fes:UpperBoundary><fes:Literal>2010</fes:Literal></fes:UpperBoundary></fes:PropertyIsBetween>`, ""},
+		{"arithmetic and function", ogcFilter, `<ogc:PropertyIsGreaterThan><ogc:Add><ogc:PropertyName>a</ogc:PropertyName><ogc:Literal>1</ogc:Literal></ogc:Add><ogc:Function name="strLength"><ogc:PropertyName>b</ogc:PropertyName></ogc:Function></ogc:PropertyIsGreaterThan>`, ""},
+		{"bbox without property", fesFilter, `<fes:BBOX><gml:Envelope srsName="EPSG:28992"><gml:lowerCorner>0 0</gml:lowerCorner><gml:upperCorner>1 1</gml:upperCorner></gml:Envelope></fes:BBOX>`, ""},
+		{"dwithin", ogcFilter, `<ogc:DWithin><ogc:PropertyName>geom</ogc:PropertyName><gml:Point><gml:coordinates>1,1</gml:coordinates></gml:Point><ogc:Distance units="m">10</ogc:Distance></ogc:DWithin>`, ""},
+		{"feature ids", ogcFilter, `<ogc:FeatureId fid="a.1"/><ogc:FeatureId fid="a.2"/>`, ""},
+		{"resource id in a logical operator", fesFilter, `<fes:Or><fes:ResourceId rid="a.1"/><fes:ResourceId rid="a.2"/></fes:Or>`, ""},
+
+		{"other namespace", `<Filter xmlns="urn:other">%s</Filter>`, `<PropertyIsNull/>`, "unsupported filter namespace"},
+		{"empty", ogcFilter, ``, "filter is empty"},
+		{"two operators", ogcFilter, `<ogc:PropertyIsNull><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsNull><ogc:PropertyIsNull><ogc:PropertyName>b</ogc:PropertyName></ogc:PropertyIsNull>`, "exactly one operator"},
+		{"unknown operator", ogcFilter, `<ogc:PropertyIsSimilar><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsSimilar>`, "unsupported filter operator"},
+		{"foreign element", ogcFilter, `<x:Anything xmlns:x="urn:x"/>`, "unsupported filter element"},
+		{"and with one operator", ogcFilter, `<ogc:And><ogc:PropertyIsNull><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsNull></ogc:And>`, "at least two operators"},
+		{"not with two operators", ogcFilter, `<ogc:Not><ogc:PropertyIsNull><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsNull><ogc:PropertyIsNull><ogc:PropertyName>b</ogc:PropertyName></ogc:PropertyIsNull></ogc:Not>`, "exactly one operator"},
+		{"comparison with one expression", ogcFilter, `<ogc:PropertyIsEqualTo><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsEqualTo>`, "exactly two expressions"},
+		{"empty property name", ogcFilter, `<ogc:PropertyIsNull><ogc:PropertyName> </ogc:PropertyName></ogc:PropertyIsNull>`, "must contain a property name"},
+		{"nested property name", ogcFilter, `<ogc:PropertyIsNull><ogc:PropertyName><ogc:Literal>a</ogc:Literal></ogc:PropertyName></ogc:PropertyIsNull>`, "must contain a property name"},
+		{"unknown expression", ogcFilter, `<ogc:PropertyIsNull><ogc:Sql>1=1</ogc:Sql></ogc:PropertyIsNull>`, "unsupported expression"},
+		{"function without a name", ogcFilter, `<ogc:PropertyIsNull><ogc:Function/></ogc:PropertyIsNull>`, "must have a name"},
+		{"between without boundaries", ogcFilter, `<ogc:PropertyIsBetween><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsBetween>`, "LowerBoundary and an UpperBoundary"},
+		{"dwithin without distance", ogcFilter, `<ogc:DWithin><ogc:PropertyName>geom</ogc:PropertyName><gml:Point/></ogc:DWithin>`, "must contain a Distance"},
+		{"distance without units", ogcFilter, `<ogc:DWithin><ogc:PropertyName>geom</ogc:PropertyName><gml:Point/><ogc:Distance>10</ogc:Distance></ogc:DWithin>`, "Distance with units"},
+		{"spatial without geometry", ogcFilter, `<ogc:Intersects><ogc:PropertyName>geom</ogc:PropertyName></ogc:Intersects>`, "a property and a geometry"},
+		{"feature id with another operator", ogcFilter, `<ogc:FeatureId fid="a.1"/><ogc:PropertyIsNull><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsNull>`, "can not be combined"},
+		{"feature id without id", ogcFilter, `<ogc:FeatureId/>`, "must have a fid attribute"},
+		{"feature id with content", ogcFilter, `<ogc:FeatureId fid="a.1">x</ogc:FeatureId>`, "must be empty"},
+		{"text between operators", ogcFilter, `<ogc:And>1=1<ogc:PropertyIsNull><ogc:PropertyName>a</ogc:PropertyName></ogc:PropertyIsNull><ogc:PropertyIsNull><ogc:PropertyName>b</ogc:PropertyName></ogc:PropertyIsNull></ogc:And>`, "unexpected text"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var filter Filter
+			err := xml.Unmarshal([]byte(strings.Replace(test.filter, "%s", test.body, 1)), &filter)
+
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestFilterFeatureIDs(t *testing.T) {
+	body := strings.Replace(fesFilter, "%s", `<fes:And><fes:Or><fes:ResourceId rid="a.1"/><fes:ResourceId rid="a.2"/></fes:Or><fes:Intersects><fes:ValueReference>geom</fes:ValueReference><gml:Polygon/></fes:Intersects></fes:And>`, 1)
+
+	var filter Filter
+	if err := xml.Unmarshal([]byte(body), &filter); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := filter.FeatureIDs(); !reflect.DeepEqual(ids, []string{"a.1", "a.2"}) {
+		t.Errorf("FeatureIDs() = %v, want [a.1 a.2]", ids)
+	}
+}
+
+func TestFilterRoundTrip(t *testing.T) {
+	body := strings.Replace(ogcFilter, "%s", `<ogc:PropertyIsEqualTo><ogc:PropertyName>ws:naam</ogc:PropertyName><ogc:Literal>a &amp; b</ogc:Literal></ogc:PropertyIsEqualTo>`, 1)
+
+	var filter Filter
+	if err := xml.Unmarshal([]byte(body), &filter); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := xml.Marshal(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Filter
+	if err := xml.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("%v in %s", err, encoded)
+	}
+
+	if decoded.XMLName.Space != ogcNamespace {
+		t.Errorf("filter namespace %q in %s", decoded.XMLName.Space, encoded)
+	}
+
+	comparison := decoded.Predicates[0]
+	if comparison.Nodes[0].Text != "ws:naam" || comparison.Nodes[1].Text != "a & b" {
+		t.Errorf("predicate was not preserved in %s", encoded)
+	}
+}
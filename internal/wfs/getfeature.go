@@ -0,0 +1,311 @@
+package wfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+const ogcNamespace = "http://www.opengis.net/ogc"
+
+var ErrNoAllowedProperties = errors.New("none of the requested properties are allowed")
+
+// GetFeature is an XML encoded GetFeature or GetPropertyValue request, the
+// latter of which has a single query and a value reference.
+type GetFeature struct {
+	XMLName        xml.Name
+	Service        string  `xml:"service,attr"`
+	Version        string  `xml:"version,attr"`
+	OutputFormat   string  `xml:"outputFormat,attr"`
+	ValueReference string  `xml:"valueReference,attr"`
+	Queries        []Query `xml:"Query"`
+	StoredQueries  []Node  `xml:"StoredQuery"`
+}
+
+type Query struct {
+	TypeName      string    `xml:"typeName,attr"`
+	TypeNames     string    `xml:"typeNames,attr"`
+	PropertyNames []string  `xml:"PropertyName"`
+	Filter        *XMLValue `xml:"Filter"`
+	SortBy        *XMLValue `xml:"SortBy"`
+}
+
+// DescribeFeatureType is an XML encoded DescribeFeatureType request. Without
+// type names, all feature types are described.
+type DescribeFeatureType struct {
+	XMLName      xml.Name
+	Service      string   `xml:"service,attr"`
+	Version      string   `xml:"version,attr"`
+	OutputFormat string   `xml:"outputFormat,attr"`
+	TypeNames    []string `xml:"TypeName"`
+}
+
+// TypeNames returns the feature types queried by all queries of the request.
+func (g GetFeature) TypeNames() []string {
+	var typeNames []string
+	for _, query := range g.Queries {
+		typeNames = append(typeNames, query.Names()...)
+	}
+
+	return typeNames
+}
+
+// Filters returns the content of the filters of all queries of the request.
+func (g GetFeature) Filters() []string {
+	var filters []string
+	for _, query := range g.Queries {
+		if query.Filter != nil {
+			filters = append(filters, strings.TrimSpace(string(query.Filter.Inner)))
+		}
+	}
+
+	return filters
+}
+
+// Names returns the feature types of the query, which can be joined in WFS 2.0.
+func (q Query) Names() []string {
+	return strings.Fields(q.TypeName + " " + q.TypeNames)
+}
+
+// RootElement returns the name of the root element of an XML document.
+func RootElement(body []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// ProjectPropertyNames restricts the PROPERTYNAME parameter of a KVP GetFeature
+// request for typeNames to the properties allowed by policy. When no properties
+// were requested for a restricted type, all allowed properties are requested
+// instead. The second return value is false when the request can not be
+// expressed with a restricted PROPERTYNAME, in which case it should be left as
+// is and features are only filtered in the response.
+func ProjectPropertyNames(typeNames []string, propertyName string, policy feature.AttributePolicy) (string, bool, error) {
+	requested := splitPropertyNames(propertyName, len(typeNames))
+
+	projected := make([][]string, len(typeNames))
+	for i, typeName := range typeNames {
+		allowed, restricted := policy.Restricted(typeName)
+		if !restricted {
+			if len(requested[i]) == 0 && len(typeNames) > 1 {
+				return propertyName, false, nil
+			}
+
+			projected[i] = requested[i]
+			continue
+		}
+
+		if len(requested[i]) == 0 {
+			projected[i] = allowed
+			continue
+		}
+
+		for _, name := range requested[i] {
+			if policy.Allows(typeName, name) {
+				projected[i] = append(projected[i], name)
+			}
+		}
+
+		if len(projected[i]) == 0 {
+			return "", false, ErrNoAllowedProperties
+		}
+	}
+
+	if len(projected) == 1 {
+		return strings.Join(projected[0], ","), true, nil
+	}
+
+	var value strings.Builder
+	for _, names := range projected {
+		value.WriteString("(" + strings.Join(names, ",") + ")")
+	}
+
+	return value.String(), true, nil
+}
+
+func splitPropertyNames(value string, typeCount int) [][]string {
+	lists := make([][]string, typeCount)
+	if value == "" {
+		return lists
+	}
+
+	if !strings.HasPrefix(value, "(") {
+		for i := range lists {
+			lists[i] = strings.Split(value, ",")
+		}
+
+		return lists
+	}
+
+	groups := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "("), ")"), ")(")
+	for i := range lists {
+		if i < len(groups) && groups[i] != "" {
+			lists[i] = strings.Split(groups[i], ",")
+		}
+	}
+
+	return lists
+}
+
+type edit struct {
+	start, end  int64
+	replacement string
+}
+
+// ProjectGetFeature restricts the PropertyName elements of the queries in an
+// XML GetFeature request to the properties allowed by policy. Queries for a
+// restricted type without PropertyName elements are given one for every allowed
+// property. The document is edited in place to keep the remainder of the
+// request exactly as the client sent it.
+func ProjectGetFeature(body []byte, policy feature.AttributePolicy) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	var (
+		edits      []edit
+		depth      int
+		version    string
+		typeName   string
+		restricted bool
+		allowed    []string
+		queryStart int64
+		queryEnd   int64
+		queryName  xml.Name
+		kept       int
+		removed    int
+	)
+
+	for {
+		offset := decoder.InputOffset()
+
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+
+			if depth == 1 {
+				version = attrValue(t.Attr, "version")
+			}
+
+			if depth == 2 && t.Name.Local == "Query" {
+				// Joins can not be projected reliably, features of joined
+				// types are only filtered in the response.
+				names := strings.Fields(attrValue(t.Attr, "typeName") + " " + attrValue(t.Attr, "typeNames"))
+				restricted = false
+				if len(names) == 1 {
+					typeName = names[0]
+					allowed, restricted = policy.Restricted(typeName)
+				}
+
+				queryStart, queryEnd, queryName = offset, decoder.InputOffset(), t.Name
+				kept, removed = 0, 0
+			}
+
+			if depth == 3 && restricted && t.Name.Local == "PropertyName" {
+				var name string
+				if err := decoder.DecodeElement(&name, &t); err != nil {
+					return nil, err
+				}
+				depth--
+
+				if policy.Allows(typeName, strings.TrimSpace(name)) {
+					kept++
+				} else {
+					removed++
+					edits = append(edits, edit{start: offset, end: decoder.InputOffset()})
+				}
+			}
+		case xml.EndElement:
+			if depth == 2 && t.Name.Local == "Query" && restricted {
+				if kept == 0 && removed > 0 {
+					return nil, ErrNoAllowedProperties
+				}
+
+				if kept == 0 {
+					edits = append(edits, propertyNameEdit(body, queryStart, queryEnd, queryName, version, allowed))
+				}
+
+				restricted = false
+			}
+
+			depth--
+		}
+	}
+
+	return applyEdits(body, edits), nil
+}
+
+// propertyNameEdit returns the edit that inserts PropertyName elements for the
+// allowed properties directly after the start tag of a query.
+func propertyNameEdit(body []byte, start int64, end int64, name xml.Name, version string, allowed []string) edit {
+	namespace := name.Space
+	if version == "1.0.0" {
+		namespace = ogcNamespace
+	}
+
+	var propertyNames strings.Builder
+	for _, property := range allowed {
+		propertyNames.WriteString(`<PropertyName xmlns="` + namespace + `">`)
+		xml.EscapeText(&propertyNames, []byte(property))
+		propertyNames.WriteString(`</PropertyName>`)
+	}
+
+	startTag := string(body[start:end])
+	if !strings.HasSuffix(startTag, "/>") {
+		return edit{start: end, end: end, replacement: propertyNames.String()}
+	}
+
+	// A self-closing query is expanded so it can contain the property names.
+	qualifiedName := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(startTag, "<"), "/>"))[0]
+
+	return edit{
+		start:       end - 2,
+		end:         end,
+		replacement: ">" + propertyNames.String() + "</" + qualifiedName + ">",
+	}
+}
+
+func applyEdits(body []byte, edits []edit) []byte {
+	if len(edits) == 0 {
+		return body
+	}
+
+	var edited bytes.Buffer
+	var last int64
+	for _, e := range edits {
+		edited.Write(body[last:e.start])
+		edited.WriteString(e.replacement)
+		last = e.end
+	}
+	edited.Write(body[last:])
+
+	return edited.Bytes()
+}
+
+func attrValue(attrs []xml.Attr, local string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,121 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+func TestProjectPropertyNames(t *testing.T) {
+	policy := feature.AttributePolicy{
+		"ws:percelen": {"naam", "oppervlakte"},
+		"ws:wegen":    {"*"},
+	}
+
+	tests := []struct {
+		name         string
+		typeNames    []string
+		propertyName string
+		want         string
+		projected    bool
+		err          error
+	}{
+		{"allowed properties of all properties", []string{"ws:percelen"}, "", "naam,oppervlakte", true, nil},
+		{"requested properties", []string{"ws:percelen"}, "naam,eigenaar", "naam", true, nil},
+		{"local name", []string{"percelen"}, "oppervlakte", "oppervlakte", true, nil},
+		{"unrestricted type", []string{"ws:wegen"}, "eigenaar", "eigenaar", true, nil},
+		{"no allowed property", []string{"ws:percelen"}, "eigenaar", "", false, ErrNoAllowedProperties},
+		{"per type", []string{"ws:percelen", "ws:wegen"}, "(eigenaar,naam)(breedte)", "(naam)(breedte)", true, nil},
+		{"unrestricted type without properties", []string{"ws:percelen", "ws:wegen"}, "(naam)", "(naam)", false, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, projected, err := ProjectPropertyNames(test.typeNames, test.propertyName, policy)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if got != test.want || projected != test.projected {
+				t.Errorf("got %q (%t), want %q (%t)", got, projected, test.want, test.projected)
+			}
+		})
+	}
+}
+
+func TestProjectGetFeature(t *testing.T) {
+	policy := feature.AttributePolicy{"ws:percelen": {"naam", "oppervlakte"}}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+		err  error
+	}{
+		{
+			name: "removed property",
+			body: `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" version="1.1.0"><wfs:Query typeName="ws:percelen"><wfs:PropertyName>naam</wfs:PropertyName><wfs:PropertyName>eigenaar</wfs:PropertyName></wfs:Query></wfs:GetFeature>`,
+			want: `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" version="1.1.0"><wfs:Query typeName="ws:percelen"><wfs:PropertyName>naam</wfs:PropertyName></wfs:Query></wfs:GetFeature>`,
+		},
+		{
+			name: "added properties",
+			body: `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" version="1.1.0"><wfs:Query typeName="ws:percelen"/></wfs:GetFeature>`,
+			want: `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" version="1.1.0"><wfs:Query typeName="ws:percelen"><PropertyName xmlns="http://www.opengis.net/wfs">naam</PropertyName><PropertyName xmlns="http://www.opengis.net/wfs">oppervlakte</PropertyName></wfs:Query></wfs:GetFeature>`,
+		},
+		{
+			name: "added properties in the ogc namespace for WFS 1.0",
+			body: `<GetFeature xmlns="http://www.opengis.net/wfs" version="1.0.0"><Query typeName="ws:percelen"></Query></GetFeature>`,
+			want: `<GetFeature xmlns="http://www.opengis.net/wfs" version="1.0.0"><Query typeName="ws:percelen"><PropertyName xmlns="http://www.opengis.net/ogc">naam</PropertyName><PropertyName xmlns="http://www.opengis.net/ogc">oppervlakte</PropertyName></Query></GetFeature>`,
+		},
+		{
+			name: "unrestricted type",
+			body: `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" version="1.1.0"><wfs:Query typeName="ws:wegen"><wfs:PropertyName>eigenaar</wfs:PropertyName></wfs:Query></wfs:GetFeature>`,
+			want: `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" version="1.1.0"><wfs:Query typeName="ws:wegen"><wfs:PropertyName>eigenaar</wfs:PropertyName></wfs:Query></wfs:GetFeature>`,
+		},
+		{
+			name: "no allowed property",
+			body: `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" version="1.1.0"><wfs:Query typeName="ws:percelen"><wfs:PropertyName>eigenaar</wfs:PropertyName></wfs:Query></wfs:GetFeature>`,
+			err:  ErrNoAllowedProperties,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ProjectGetFeature([]byte(test.body), policy)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if err == nil && string(got) != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetFeatureTypeNames(t *testing.T) {
+	body := `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" version="2.0.0">` +
+		`<wfs:Query typeNames="ws:percelen ws:eigenaren"><fes:Filter><fes:ResourceId rid="p.1"/></fes:Filter></wfs:Query>` +
+		`<wfs:Query typeNames="ws:wegen"/></wfs:GetFeature>`
+
+	name, err := RootElement([]byte(body))
+	if err != nil || name.Local != "GetFeature" {
+		t.Fatalf("RootElement() = %v, %v", name, err)
+	}
+
+	var getFeature GetFeature
+	if err := xml.Unmarshal([]byte(body), &getFeature); err != nil {
+		t.Fatal(err)
+	}
+
+	if typeNames := strings.Join(getFeature.TypeNames(), ","); typeNames != "ws:percelen,ws:eigenaren,ws:wegen" {
+		t.Errorf("TypeNames() = %s", typeNames)
+	}
+
+	if filters := getFeature.Filters(); len(filters) != 1 || !strings.Contains(filters[0], `rid="p.1"`) {
+		t.Errorf("Filters() = %q", filters)
+	}
+}
@@ -0,0 +1,74 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Node is a generic XML element that is decoded with resolved namespaces and
+// can be written back without losing the meaning of the original document.
+type Node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",chardata"`
+	Nodes   []Node     `xml:",any"`
+}
+
+// MarshalXML writes the node, keeping namespace declarations of the original
+// element so that prefixes used in attribute values and text still resolve.
+func (n Node) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = n.XMLName
+	start.Attr = literalAttrs(n.Attrs)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if len(n.Nodes) == 0 || strings.TrimSpace(n.Text) != "" {
+		if err := e.EncodeToken(xml.CharData(n.Text)); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range n.Nodes {
+		if err := e.Encode(child); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// Attr returns the value of the attribute with the given local name.
+func (n Node) Attr(local string) string {
+	return attrValue(n.Attrs, local)
+}
+
+// literalAttrs converts prefixed namespace declarations and attributes in a
+// namespace declared on the same element to literal names, which encoding/xml
+// writes as is. Default namespace declarations are dropped, as the encoder
+// declares the namespace of every element it writes itself.
+func literalAttrs(attrs []xml.Attr) []xml.Attr {
+	prefixes := map[string]string{}
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" {
+			prefixes[attr.Value] = attr.Name.Local
+		}
+	}
+
+	var literal []xml.Attr
+	for _, attr := range attrs {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			continue
+		case attr.Name.Space == "xmlns":
+			attr.Name = xml.Name{Local: "xmlns:" + attr.Name.Local}
+		case prefixes[attr.Name.Space] != "":
+			attr.Name = xml.Name{Local: prefixes[attr.Name.Space] + ":" + attr.Name.Local}
+		}
+
+		literal = append(literal, attr)
+	}
+
+	return literal
+}
@@ -0,0 +1,199 @@
+package wfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+// QueryTypeNames returns the feature types of the TYPENAME and TYPENAMES
+// parameters of a KVP request, of which the keys are in lower case.
+func QueryTypeNames(params url.Values) []string {
+	var typeNames []string
+	for _, key := range []string{"typename", "typenames"} {
+		for _, name := range strings.Split(params.Get(key), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				typeNames = append(typeNames, name)
+			}
+		}
+	}
+
+	return typeNames
+}
+
+// CheckReferences returns an error when the filter or sort order of a query
+// in an XML GetFeature request refers to a property that policy does not
+// allow, as the values of hidden properties could be inferred from the
+// features that are selected or from their order.
+func (g GetFeature) CheckReferences(policy feature.AttributePolicy) error {
+	for _, query := range g.Queries {
+		for _, content := range []*XMLValue{query.Filter, query.SortBy} {
+			if content == nil {
+				continue
+			}
+
+			names, err := xmlReferences(content.Inner)
+			if err != nil {
+				return err
+			}
+
+			if err := checkReferences(query.Names(), names, policy); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckQueryReferences returns an error when the CQL_FILTER, FILTER or SORTBY
+// parameter of a KVP GetFeature request for typeNames refers to a property
+// that policy does not allow. The keys of params are in lower case.
+func CheckQueryReferences(typeNames []string, params url.Values, policy feature.AttributePolicy) error {
+	names := cqlReferences(params.Get("cql_filter"))
+
+	filterNames, err := xmlReferences([]byte(params.Get("filter")))
+	if err != nil {
+		return err
+	}
+	names = append(names, filterNames...)
+
+	for _, sortBy := range strings.Split(params.Get("sortby"), ",") {
+		if fields := strings.Fields(sortBy); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+
+	return checkReferences(typeNames, names, policy)
+}
+
+// checkReferences checks property references against the policy of every type
+// of a query, unless the reference starts with the name of one of the types.
+func checkReferences(typeNames []string, names []string, policy feature.AttributePolicy) error {
+	for _, name := range names {
+		steps := strings.Split(strings.TrimSpace(name), "/")
+		property := steps[0]
+
+		referenced := typeNames
+		if len(steps) > 1 {
+			for _, typeName := range typeNames {
+				if feature.LocalName(steps[0]) == feature.LocalName(typeName) {
+					referenced, property = []string{typeName}, steps[1]
+				}
+			}
+		}
+
+		if i := strings.Index(property, "["); i >= 0 {
+			property = property[:i]
+		}
+
+		for _, typeName := range referenced {
+			if !policy.Allows(typeName, property) {
+				return fmt.Errorf("property %s of %s is not allowed in a filter or sort order", property, typeName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// xmlReferences returns the content of the PropertyName and ValueReference
+// elements in filter or sort order XML.
+func xmlReferences(content []byte) ([]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = false
+
+	var names []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok && (start.Name.Local == "PropertyName" || start.Name.Local == "ValueReference") {
+			var name string
+			if err := decoder.DecodeElement(&name, &start); err != nil {
+				return nil, err
+			}
+
+			names = append(names, name)
+		}
+	}
+}
+
+// cqlWords are the keywords and units of (E)CQL, which are not property names.
+var cqlWords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "ILIKE": true, "IS": true,
+	"NULL": true, "BETWEEN": true, "IN": true, "EXISTS": true, "EXIST": true,
+	"DOES": true, "INCLUDE": true, "EXCLUDE": true, "TRUE": true, "FALSE": true,
+	"BEFORE": true, "AFTER": true, "DURING": true, "TEQUALS": true, "EMPTY": true,
+	"METERS": true, "FEET": true, "STATUTE": true, "NAUTICAL": true, "MILES": true,
+	"KILOMETERS": true,
+}
+
+// cqlReferences returns the identifiers in a CQL or ECQL filter that are not
+// keywords, functions or geometry types, which are the properties it refers to.
+// Several filters can be separated by semicolons.
+func cqlReferences(cql string) []string {
+	var names []string
+
+	runes := []rune(cql)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\'':
+			// String literals escape quotes by doubling them.
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			names = append(names, string(runes[i+1:min(end, len(runes))]))
+			i = end + 1
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || strings.ContainsRune("_:./", runes[end])) {
+				end++
+			}
+			word := string(runes[i:end])
+
+			next := end
+			for next < len(runes) && unicode.IsSpace(runes[next]) {
+				next++
+			}
+
+			if (next >= len(runes) || runes[next] != '(') && !cqlWords[strings.ToUpper(word)] {
+				names = append(names, word)
+			}
+			i = end
+		case unicode.IsDigit(r):
+			// Numbers and dates, such as 2006-11-30T01:30:00Z.
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune(".:+-", runes[i])) {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,85 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+func TestQueryTypeNames(t *testing.T) {
+	params := url.Values{"typename": {"ws:percelen"}, "typenames": {"ws:wegen, ws:gebouwen"}}
+	if got := QueryTypeNames(params); !reflect.DeepEqual(got, []string{"ws:percelen", "ws:wegen", "ws:gebouwen"}) {
+		t.Errorf("got %q", got)
+	}
+
+	if got := QueryTypeNames(url.Values{"featureid": {"percelen.1"}}); len(got) != 0 {
+		t.Errorf("got %q, want no type names", got)
+	}
+}
+
+func TestCheckQueryReferences(t *testing.T) {
+	policy := feature.AttributePolicy{"ws:percelen": {"naam", "geom"}}
+
+	tests := []struct {
+		name   string
+		params url.Values
+		err    string
+	}{
+		{name: "allowed cql", params: url.Values{"cql_filter": {`naam LIKE 'a%' AND INTERSECTS(geom, POINT(1 2)) AND "naam" IS NOT NULL`}}},
+		{name: "cql on a hidden property", params: url.Values{"cql_filter": {`naam = 'a' OR eigenaar = 'b'`}}, err: "property eigenaar of ws:percelen"},
+		{name: "hidden property in a string", params: url.Values{"cql_filter": {`naam = 'eigenaar = ''b'''`}}},
+		{name: "cql with units and dates", params: url.Values{"cql_filter": {`DWITHIN(geom, POINT(1 2), 10, meters) AND naam AFTER 2006-11-30T01:30:00Z`}}},
+		{name: "quoted hidden property", params: url.Values{"cql_filter": {`"eigenaar" = 'b'`}}, err: "property eigenaar"},
+		{name: "cql function on a hidden property", params: url.Values{"cql_filter": {`strToLowerCase(eigenaar) = 'b'`}}, err: "property eigenaar"},
+		{name: "xml filter on a hidden property", params: url.Values{"filter": {`<Filter><PropertyIsEqualTo><PropertyName>ws:percelen/eigenaar</PropertyName><Literal>b</Literal></PropertyIsEqualTo></Filter>`}}, err: "property eigenaar"},
+		{name: "xml filter on an allowed property", params: url.Values{"filter": {`(<Filter><PropertyIsEqualTo><PropertyName>naam</PropertyName><Literal>b</Literal></PropertyIsEqualTo></Filter>)`}}},
+		{name: "sort by a hidden property", params: url.Values{"sortby": {"naam A,eigenaar D"}}, err: "property eigenaar"},
+		{name: "sort by an allowed property", params: url.Values{"sortby": {"naam DESC"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckQueryReferences([]string{"ws:percelen"}, test.params, policy)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestGetFeatureCheckReferences(t *testing.T) {
+	policy := feature.AttributePolicy{"ws:percelen": {"naam"}}
+
+	tests := []struct {
+		name  string
+		query string
+		err   bool
+	}{
+		{name: "filter on an allowed property", query: `<fes:Filter><fes:PropertyIsEqualTo><fes:ValueReference>naam</fes:ValueReference><fes:Literal>a</fes:Literal></fes:PropertyIsEqualTo></fes:Filter>`},
+		{name: "filter on a hidden property", query: `<fes:Filter><fes:PropertyIsLessThan><fes:ValueReference>ws:waarde</fes:ValueReference><fes:Literal>100</fes:Literal></fes:PropertyIsLessThan></fes:Filter>`, err: true},
+		{name: "sort by a hidden property", query: `<fes:SortBy><fes:SortProperty><fes:ValueReference>waarde</fes:ValueReference></fes:SortProperty></fes:SortBy>`, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := `<wfs:GetFeature version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0">` +
+				`<wfs:Query typeNames="ws:percelen">` + test.query + `</wfs:Query></wfs:GetFeature>`
+
+			var getFeature GetFeature
+			if err := xml.Unmarshal([]byte(body), &getFeature); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := getFeature.CheckReferences(policy); (err != nil) != test.err {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TransactionResponse summarizes the response of a backend to a transaction.
+// WFS 1.0.0 responses have no totals, only the identifiers of new features and
+// a status, which is FAILED when the transaction was rolled back.
+type TransactionResponse struct {
+	Status        string   `json:"status,omitempty"`
+	Message       string   `json:"message,omitempty"`
+	TotalInserted int      `json:"totalInserted"`
+	TotalUpdated  int      `json:"totalUpdated"`
+	TotalReplaced int      `json:"totalReplaced"`
+	TotalDeleted  int      `json:"totalDeleted"`
+	InsertedIDs   []string `json:"insertedIds"`
+}
+
+// ParseTransactionResponse parses a WFS 1.0.0 WFS_TransactionResponse or a
+// WFS 1.1.0 or 2.0 TransactionResponse.
+func ParseTransactionResponse(body []byte) (*TransactionResponse, error) {
+	var root Node
+	if err := xml.Unmarshal(body, &root); err != nil {
+		return nil, err
+	}
+
+	if root.XMLName.Local != "TransactionResponse" && root.XMLName.Local != "WFS_TransactionResponse" {
+		return nil, fmt.Errorf("unexpected transaction response: %s", root.XMLName.Local)
+	}
+
+	response := &TransactionResponse{}
+	var walk func(node Node, inInsertResults bool) error
+	walk = func(node Node, inInsertResults bool) error {
+		text := strings.TrimSpace(node.Text)
+
+		var err error
+		switch node.XMLName.Local {
+		case "totalInserted":
+			response.TotalInserted, err = strconv.Atoi(text)
+		case "totalUpdated":
+			response.TotalUpdated, err = strconv.Atoi(text)
+		case "totalReplaced":
+			response.TotalReplaced, err = strconv.Atoi(text)
+		case "totalDeleted":
+			response.TotalDeleted, err = strconv.Atoi(text)
+		case "Status":
+			if len(node.Nodes) > 0 {
+				response.Status = node.Nodes[0].XMLName.Local
+			}
+		case "Message":
+			response.Message = text
+		case "InsertResults", "InsertResult":
+			inInsertResults = true
+		case "FeatureId":
+			if inInsertResults {
+				response.InsertedIDs = append(response.InsertedIDs, node.Attr("fid"))
+			}
+		case "ResourceId":
+			if inInsertResults {
+				response.InsertedIDs = append(response.InsertedIDs, node.Attr("rid"))
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", node.XMLName.Local, err)
+		}
+
+		for _, child := range node.Nodes {
+			if err := walk(child, inInsertResults); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(root, false); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ActionSummary describes the changes made by a single action of a transaction.
+type ActionSummary struct {
+	Action     string   `json:"action"`
+	Layer      string   `json:"layer"`
+	FeatureIDs []string `json:"featureIds,omitempty"`
+	Properties []string `json:"properties,omitempty"`
+}
+
+// Summary describes the actions of the transaction in the order in which they
+// are executed. The features of an insert or replace are described separately.
+// Layers are named as in the typeName attribute of an update or delete.
+func (t Transaction) Summary() []ActionSummary {
+	var summaries []ActionSummary
+
+	indices := map[string]int{}
+	for _, name := range t.actionOrder() {
+		i := indices[name]
+		indices[name]++
+
+		switch name {
+		case "Insert":
+			summaries = append(summaries, t.featureSummaries("insert", t.Inserts[i].Layers, t.Inserts[i].Attrs, nil)...)
+		case "Update":
+			update := t.Updates[i]
+			summary := ActionSummary{Action: "update", Layer: update.TypeName}
+			if update.Filter != nil {
+				summary.FeatureIDs = update.Filter.FeatureIDs()
+			}
+			for _, property := range update.Props {
+				summary.Properties = append(summary.Properties, property.PropertyName())
+			}
+			summaries = append(summaries, summary)
+		case "Replace":
+			replace := t.Replaces[i]
+			var ids []string
+			if replace.Filter != nil {
+				ids = replace.Filter.FeatureIDs()
+			}
+			summaries = append(summaries, t.featureSummaries("replace", replace.Layers, replace.Attrs, ids)...)
+		case "Delete":
+			deleteAction := t.Deletes[i]
+			summary := ActionSummary{Action: "delete", Layer: deleteAction.TypeName}
+			if deleteAction.Filter != nil {
+				summary.FeatureIDs = deleteAction.Filter.FeatureIDs()
+			}
+			summaries = append(summaries, summary)
+		case "Native":
+			summaries = append(summaries, ActionSummary{Action: "native", Layer: t.Natives[i].VendorID})
+		}
+	}
+
+	return summaries
+}
+
+func (t Transaction) featureSummaries(action string, layers []Layer, actionAttrs []xml.Attr, ids []string) []ActionSummary {
+	var summaries []ActionSummary
+	for _, layer := range layers {
+		typeName, err := t.TypeName(layer, actionAttrs)
+		if err != nil {
+			typeName = layer.XMLName.Local
+		}
+
+		summary := ActionSummary{Action: action, Layer: typeName, FeatureIDs: ids}
+		if id := attrValue(layer.Attrs, "fid"); id != "" && ids == nil {
+			summary.FeatureIDs = []string{id}
+		} else if id := attrValue(layer.Attrs, "id"); id != "" && ids == nil {
+			summary.FeatureIDs = []string{id}
+		}
+
+		for _, property := range layer.Content {
+			summary.Properties = append(summary.Properties, property.XMLName.Local)
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
@@ -0,0 +1,86 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/delta10/filter-proxy/internal/geometry"
+)
+
+func TestSummary(t *testing.T) {
+	body := `<wfs:Transaction service="WFS" version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:ws="urn:ws">` +
+		`<wfs:Insert><ws:percelen><ws:naam>a</ws:naam></ws:percelen></wfs:Insert>` +
+		`<wfs:Update typeName="ws:percelen"><wfs:Property><wfs:ValueReference>naam</wfs:ValueReference><wfs:Value>b</wfs:Value></wfs:Property><fes:Filter><fes:ResourceId rid="percelen.1"/></fes:Filter></wfs:Update>` +
+		`<wfs:Delete typeName="ws:percelen"><fes:Filter><fes:ResourceId rid="percelen.2"/><fes:ResourceId rid="percelen.3"/></fes:Filter></wfs:Delete>` +
+		`</wfs:Transaction>`
+
+	var transaction Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	area, err := geometry.ParseWKT("POLYGON((0 0, 10 0, 10 10, 0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The identifiers remain part of the summary once the filters are
+	// restricted to an area.
+	restriction := AreaRestriction{Area: area, CRS: "EPSG:28992", Property: "geometrie"}
+	if err := transaction.RestrictToAreas(map[ActionKey]AreaRestriction{{"ws:percelen", "update"}: restriction, {"ws:percelen", "delete"}: restriction}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ActionSummary{
+		{Action: "insert", Layer: "ws:percelen", Properties: []string{"naam"}},
+		{Action: "update", Layer: "ws:percelen", FeatureIDs: []string{"percelen.1"}, Properties: []string{"naam"}},
+		{Action: "delete", Layer: "ws:percelen", FeatureIDs: []string{"percelen.2", "percelen.3"}},
+	}
+
+	if got := transaction.Summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseTransactionResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want TransactionResponse
+	}{
+		{
+			name: "wfs 2.0",
+			body: `<wfs:TransactionResponse xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0">` +
+				`<wfs:TransactionSummary><wfs:totalInserted>1</wfs:totalInserted><wfs:totalUpdated>2</wfs:totalUpdated><wfs:totalReplaced>0</wfs:totalReplaced><wfs:totalDeleted>3</wfs:totalDeleted></wfs:TransactionSummary>` +
+				`<wfs:InsertResults><wfs:Feature><fes:ResourceId rid="percelen.4"/></wfs:Feature></wfs:InsertResults>` +
+				`</wfs:TransactionResponse>`,
+			want: TransactionResponse{TotalInserted: 1, TotalUpdated: 2, TotalDeleted: 3, InsertedIDs: []string{"percelen.4"}},
+		},
+		{
+			name: "wfs 1.0.0",
+			body: `<wfs:WFS_TransactionResponse xmlns:wfs="http://www.opengis.net/wfs" xmlns:ogc="http://www.opengis.net/ogc">` +
+				`<wfs:InsertResult><ogc:FeatureId fid="percelen.5"/></wfs:InsertResult>` +
+				`<wfs:TransactionResult><wfs:Status><wfs:FAILED/></wfs:Status><wfs:Message>rolled back</wfs:Message></wfs:TransactionResult>` +
+				`</wfs:WFS_TransactionResponse>`,
+			want: TransactionResponse{Status: "FAILED", Message: "rolled back", InsertedIDs: []string{"percelen.5"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseTransactionResponse([]byte(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("got %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+
+	if _, err := ParseTransactionResponse([]byte(`<ows:ExceptionReport xmlns:ows="http://www.opengis.net/ows/1.1"/>`)); err == nil {
+		t.Error("expected an error for an exception report")
+	}
+}
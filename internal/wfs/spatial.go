@@ -0,0 +1,289 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/delta10/filter-proxy/internal/geometry"
+)
+
+const (
+	gml32Namespace = "http://www.opengis.net/gml/3.2"
+)
+
+// AreaRestriction limits the edits of a layer to an area. Property is the
+// geometry property that is constrained in the filters of updates, replaces
+// and deletes.
+type AreaRestriction struct {
+	Area     geometry.MultiPolygon
+	CRS      string
+	Property string
+}
+
+// RestrictToAreas rejects inserts, updates and replaces that write a geometry
+// outside of the area of their layer and operation, and constrains the filters
+// of updates, replaces and deletes to features within that area. Native actions
+// are rejected when any action is restricted, as their content can not be
+// inspected. Every area needs a coordinate reference system, as the
+// coordinates of geometries can not be compared with it otherwise.
+func (t *Transaction) RestrictToAreas(restrictions map[ActionKey]AreaRestriction) error {
+	if len(restrictions) == 0 {
+		return nil
+	}
+
+	for action, restriction := range restrictions {
+		if restriction.CRS == "" {
+			return fmt.Errorf("allowed area of %s has no coordinate reference system", action.Layer)
+		}
+	}
+
+	if len(t.Natives) > 0 {
+		return errors.New("native actions are not allowed when edits are restricted to an area")
+	}
+
+	for _, insert := range t.Inserts {
+		for _, layer := range insert.Layers {
+			typeName, err := t.TypeName(layer, insert.Attrs)
+			if err != nil {
+				return err
+			}
+
+			if restriction, ok := restrictions[ActionKey{typeName, "insert"}]; ok {
+				if err := checkFeatureGeometries(layer, restriction); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for i, update := range t.Updates {
+		restriction, ok := restrictions[ActionKey{update.TypeName, "update"}]
+		if !ok {
+			continue
+		}
+
+		for _, property := range update.Props {
+			if property.Value == nil {
+				continue
+			}
+
+			if err := checkGeometry(property.Value.Inner, restriction); err != nil {
+				return fmt.Errorf("property %s of %s: %w", property.PropertyName(), update.TypeName, err)
+			}
+		}
+
+		if err := t.restrictFilter(t.Updates[i].Filter, restriction); err != nil {
+			return fmt.Errorf("update of %s: %w", update.TypeName, err)
+		}
+	}
+
+	for i, replace := range t.Replaces {
+		for _, layer := range replace.Layers {
+			typeName, err := t.TypeName(layer, replace.Attrs)
+			if err != nil {
+				return err
+			}
+
+			restriction, ok := restrictions[ActionKey{typeName, "replace"}]
+			if !ok {
+				continue
+			}
+
+			if err := checkFeatureGeometries(layer, restriction); err != nil {
+				return err
+			}
+
+			if err := t.restrictFilter(t.Replaces[i].Filter, restriction); err != nil {
+				return fmt.Errorf("replace of %s: %w", layer.XMLName.Local, err)
+			}
+		}
+	}
+
+	for i, deleteAction := range t.Deletes {
+		restriction, ok := restrictions[ActionKey{deleteAction.TypeName, "delete"}]
+		if !ok {
+			continue
+		}
+
+		if err := t.restrictFilter(t.Deletes[i].Filter, restriction); err != nil {
+			return fmt.Errorf("delete of %s: %w", deleteAction.TypeName, err)
+		}
+	}
+
+	return nil
+}
+
+func checkFeatureGeometries(layer Layer, restriction AreaRestriction) error {
+	for _, property := range layer.Content {
+		if err := checkGeometry(property.Inner, restriction); err != nil {
+			return fmt.Errorf("property %s of %s: %w", property.XMLName.Local, layer.XMLName.Local, err)
+		}
+	}
+
+	return nil
+}
+
+// checkGeometry returns an error when the GML in content lies outside of the
+// area, or uses a different coordinate reference system than the area.
+// Content without elements is not a geometry and is always accepted, while
+// elements of which the coordinates can not be read are rejected.
+func checkGeometry(content []byte, restriction AreaRestriction) error {
+	gml, err := geometry.ParseGML(content)
+	if err != nil {
+		return fmt.Errorf("invalid geometry: %w", err)
+	}
+	if gml == nil {
+		return nil
+	}
+
+	if gml.CRS == "" {
+		return errors.New("geometry without srsName is not allowed")
+	}
+	if geometry.NormalizeCRS(gml.CRS) != geometry.NormalizeCRS(restriction.CRS) {
+		return fmt.Errorf("geometry in %s does not match the allowed area in %s", gml.CRS, restriction.CRS)
+	}
+
+	// The paths are in longitude, latitude order, the area in the axis order
+	// of its coordinate reference system.
+	if geometry.SwapsAxes(restriction.CRS) {
+		for _, path := range gml.Paths {
+			for i := range path {
+				path[i] = geometry.Point{X: path[i].Y, Y: path[i].X}
+			}
+		}
+	}
+
+	if !restriction.Area.Contains(gml.Paths) {
+		return errors.New("geometry is outside of the allowed area")
+	}
+
+	return nil
+}
+
+// restrictFilter combines the predicates of filter with a Within operator on
+// the geometry property, so that only features inside the area are affected.
+func (t Transaction) restrictFilter(filter *Filter, restriction AreaRestriction) error {
+	if filter == nil || len(filter.Predicates) == 0 {
+		return errors.New("a filter is required")
+	}
+
+	if restriction.Property == "" {
+		return errors.New("no geometry property configured")
+	}
+
+	space := filter.XMLName.Space
+	property := Node{XMLName: xml.Name{Space: space, Local: "PropertyName"}, Text: restriction.Property}
+	if space == fesNamespace {
+		property.XMLName.Local = "ValueReference"
+	}
+
+	within := Node{
+		XMLName: xml.Name{Space: space, Local: "Within"},
+		Nodes:   []Node{property, t.gmlArea(restriction)},
+	}
+
+	predicate := filter.Predicates[0]
+	if len(filter.Predicates) > 1 {
+		// Multiple identifiers select each of the identified features.
+		predicate = Node{XMLName: xml.Name{Space: space, Local: "Or"}, Nodes: filter.Predicates}
+	}
+
+	filter.Predicates = []Node{{
+		XMLName: xml.Name{Space: space, Local: "And"},
+		Nodes:   []Node{predicate, within},
+	}}
+
+	return nil
+}
+
+// gmlArea encodes the area in the GML version of the transaction: GML 2 for
+// WFS 1.0.0, GML 3.1.1 for WFS 1.1.0 and GML 3.2 for WFS 2.0.
+func (t Transaction) gmlArea(restriction AreaRestriction) Node {
+	space := gmlNamespace
+	if t.IsVersion2() {
+		space = gml32Namespace
+	}
+	gml2 := !t.IsVersion2() && t.Version == "1.0.0"
+
+	element := func(local string, nodes ...Node) Node {
+		return Node{XMLName: xml.Name{Space: space, Local: local}, Nodes: nodes}
+	}
+
+	ids := 0
+	withID := func(node Node) Node {
+		if t.IsVersion2() {
+			ids++
+			node.Attrs = append(node.Attrs,
+				xml.Attr{Name: xml.Name{Space: "xmlns", Local: "gml"}, Value: space},
+				xml.Attr{Name: xml.Name{Space: space, Local: "id"}, Value: "allowed-area-" + strconv.Itoa(ids)},
+			)
+		}
+		return node
+	}
+
+	ring := func(points []geometry.Point) Node {
+		var coordinates []string
+		for _, point := range points {
+			x := strconv.FormatFloat(point.X, 'f', -1, 64)
+			y := strconv.FormatFloat(point.Y, 'f', -1, 64)
+			if gml2 {
+				coordinates = append(coordinates, x+","+y)
+			} else {
+				coordinates = append(coordinates, x+" "+y)
+			}
+		}
+
+		if gml2 {
+			coordinatesNode := element("coordinates")
+			coordinatesNode.Text = strings.Join(coordinates, " ")
+			return element("LinearRing", coordinatesNode)
+		}
+
+		posList := element("posList")
+		posList.Text = strings.Join(coordinates, " ")
+		return element("LinearRing", posList)
+	}
+
+	polygon := func(p geometry.Polygon) Node {
+		exterior, interior := "exterior", "interior"
+		if gml2 {
+			exterior, interior = "outerBoundaryIs", "innerBoundaryIs"
+		}
+
+		var boundaries []Node
+		for i, r := range p {
+			name := interior
+			if i == 0 {
+				name = exterior
+			}
+			boundaries = append(boundaries, element(name, ring(r)))
+		}
+
+		return withID(element("Polygon", boundaries...))
+	}
+
+	var area Node
+	if len(restriction.Area) == 1 {
+		area = polygon(restriction.Area[0])
+	} else {
+		multi, member := "MultiSurface", "surfaceMember"
+		if gml2 {
+			multi, member = "MultiPolygon", "polygonMember"
+		}
+
+		var members []Node
+		for _, p := range restriction.Area {
+			members = append(members, element(member, polygon(p)))
+		}
+		area = withID(element(multi, members...))
+	}
+
+	if restriction.CRS != "" {
+		area.Attrs = append([]xml.Attr{{Name: xml.Name{Local: "srsName"}, Value: restriction.CRS}}, area.Attrs...)
+	}
+
+	return area
+}
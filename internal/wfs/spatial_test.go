@@ -0,0 +1,152 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/delta10/filter-proxy/internal/geometry"
+)
+
+func TestRestrictToAreas(t *testing.T) {
+	area, err := geometry.ParseWKT("POLYGON((4 51, 6 51, 6 53, 4 53, 4 51))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restrictions := map[ActionKey]AreaRestriction{
+		{"ws:percelen", "insert"}: {Area: area, CRS: "EPSG:4326", Property: "geometrie"},
+	}
+
+	insert := func(srsName string, pos string) string {
+		return `<wfs:Transaction service="WFS" version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:gml="http://www.opengis.net/gml/3.2" xmlns:ws="urn:ws">` +
+			`<wfs:Insert><ws:percelen><ws:geometrie><gml:Point srsName="` + srsName + `"><gml:pos>` + pos + `</gml:pos></gml:Point></ws:geometrie></ws:percelen></wfs:Insert>` +
+			`</wfs:Transaction>`
+	}
+
+	insertGML2 := func(point string) string {
+		return `<wfs:Transaction service="WFS" version="1.0.0" xmlns:wfs="http://www.opengis.net/wfs" xmlns:gml="http://www.opengis.net/gml" xmlns:ws="urn:ws">` +
+			`<wfs:Insert><ws:percelen><ws:geometrie><gml:Point srsName="EPSG:4326">` + point + `</gml:Point></ws:geometrie></ws:percelen></wfs:Insert>` +
+			`</wfs:Transaction>`
+	}
+
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{name: "inside", body: insert("EPSG:4326", "5 52")},
+		{name: "inside in latitude, longitude order", body: insert("urn:ogc:def:crs:EPSG::4326", "52 5")},
+		{name: "outside in latitude, longitude order", body: insert("urn:ogc:def:crs:EPSG::4326", "5 52"), err: "outside of the allowed area"},
+		{name: "other crs", body: insert("EPSG:28992", "5 52"), err: "does not match the allowed area"},
+		{name: "gml 2 coord", body: insertGML2("<gml:coord><gml:X>5</gml:X><gml:Y>52</gml:Y></gml:coord>")},
+		{name: "gml 2 coord outside", body: insertGML2("<gml:coord><gml:X>150000</gml:X><gml:Y>450000</gml:Y></gml:coord>"), err: "outside of the allowed area"},
+		{name: "unreadable geometry", body: insertGML2("<gml:coordinate>150000 450000</gml:coordinate>"), err: "invalid geometry"},
+		{
+			name: "native action",
+			body: `<wfs:Transaction version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0"><wfs:Native vendorId="x" safeToIgnore="false"/></wfs:Transaction>`,
+			err:  "native actions are not allowed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var transaction Transaction
+			if err := xml.Unmarshal([]byte(test.body), &transaction); err != nil {
+				t.Fatal(err)
+			}
+
+			err := transaction.RestrictToAreas(restrictions)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRestrictToAreasFilter(t *testing.T) {
+	area, err := geometry.ParseWKT("POLYGON((0 0, 10 0, 10 10, 0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `<wfs:Transaction service="WFS" version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0">` +
+		`<wfs:Delete typeName="ws:percelen"><fes:Filter><fes:ResourceId rid="percelen.1"/><fes:ResourceId rid="percelen.2"/></fes:Filter></wfs:Delete>` +
+		`</wfs:Transaction>`
+
+	var transaction Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := transaction.RestrictToAreas(map[ActionKey]AreaRestriction{{"ws:percelen", "delete"}: {Area: area, CRS: "EPSG:28992", Property: "geometrie"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := xml.Marshal(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"And", "Or", "Within", ">geometrie<", `srsName="EPSG:28992"`, `rid="percelen.2"`} {
+		if !strings.Contains(string(encoded), s) {
+			t.Errorf("%s does not contain %s", encoded, s)
+		}
+	}
+}
+
+func TestRestrictToAreasWithoutCRS(t *testing.T) {
+	area, err := geometry.ParseWKT("POLYGON((4 51, 6 51, 6 53, 4 53, 4 51))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `<wfs:Transaction service="WFS" version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:gml="http://www.opengis.net/gml/3.2" xmlns:ws="urn:ws">` +
+		`<wfs:Insert><ws:percelen><ws:geometrie><gml:Point srsName="EPSG:28992"><gml:pos>5 52</gml:pos></gml:Point></ws:geometrie></ws:percelen></wfs:Insert>` +
+		`</wfs:Transaction>`
+
+	var transaction Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	err = transaction.RestrictToAreas(map[ActionKey]AreaRestriction{{"ws:percelen", "insert"}: {Area: area, Property: "geometrie"}})
+	if err == nil || !strings.Contains(err.Error(), "has no coordinate reference system") {
+		t.Errorf("got error %v, want an area without crs to be rejected", err)
+	}
+}
+
+func TestRestrictToAreasPerOperation(t *testing.T) {
+	wide, err := geometry.ParseWKT("POLYGON((0 0, 100 0, 100 100, 0 100, 0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	narrow, err := geometry.ParseWKT("POLYGON((0 0, 10 0, 10 10, 0 10, 0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `<wfs:Transaction service="WFS" version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:gml="http://www.opengis.net/gml/3.2" xmlns:ws="urn:ws">` +
+		`<wfs:Insert><ws:percelen><ws:geometrie><gml:Point srsName="EPSG:28992"><gml:pos>50 50</gml:pos></gml:Point></ws:geometrie></ws:percelen></wfs:Insert>` +
+		`<wfs:Update typeName="ws:percelen"><wfs:Property><wfs:ValueReference>geometrie</wfs:ValueReference><wfs:Value><gml:Point srsName="EPSG:28992"><gml:pos>50 50</gml:pos></gml:Point></wfs:Value></wfs:Property><fes:Filter><fes:ResourceId rid="percelen.1"/></fes:Filter></wfs:Update>` +
+		`</wfs:Transaction>`
+
+	var transaction Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	// The insert is within its wide area, the update is outside of the narrow
+	// area of the update decision.
+	err = transaction.RestrictToAreas(map[ActionKey]AreaRestriction{
+		{"ws:percelen", "insert"}: {Area: wide, CRS: "EPSG:28992", Property: "geometrie"},
+		{"ws:percelen", "update"}: {Area: narrow, CRS: "EPSG:28992", Property: "geometrie"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "property geometrie of ws:percelen: geometry is outside of the allowed area") {
+		t.Errorf("got error %v, want the update to be rejected", err)
+	}
+}
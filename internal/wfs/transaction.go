@@ -1,20 +1,353 @@
 package wfs
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
 
+const (
+	Namespace   = "http://www.opengis.net/wfs"
+	Namespace20 = "http://www.opengis.net/wfs/2.0"
+)
+
+// Transaction is a WFS 1.x or 2.0 Transaction request.
 type Transaction struct {
-	XMLName        xml.Name       `xml:"http://www.opengis.net/wfs Transaction"`
-	Service        string         `xml:"service,attr"`
-	Version        string         `xml:"version,attr"`
-	XSI            string         `xml:",xmlns:xsi,attr"`
-	SchemaLocation string         `xml:",xsi:schemaLocation,attr"`
-	Inserts        []Action       `xml:"Insert"`
-	Updates        []UpdateAction `xml:"Update"`
-	Deletes        []DeleteAction `xml:"Delete"`
+	XMLName  xml.Name
+	Service  string
+	Version  string
+	Attrs    []xml.Attr
+	LockID   string
+	Inserts  []Action
+	Updates  []UpdateAction
+	Replaces []ReplaceAction
+	Deletes  []DeleteAction
+	Natives  []NativeAction
+	Other    []Node
+
+	// order holds the element names of the actions in document order, as the
+	// actions are executed in the order in which they appear.
+	order []string
+}
+
+func (t *Transaction) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name.Local != "Transaction" {
+		return fmt.Errorf("expected element type <Transaction> but have <%s>", start.Name.Local)
+	}
+
+	t.XMLName = start.Name
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local == "service":
+			t.Service = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "version":
+			t.Version = attr.Value
+		default:
+			t.Attrs = append(t.Attrs, attr)
+		}
+	}
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		var element xml.StartElement
+		switch token := token.(type) {
+		case xml.StartElement:
+			element = token
+		case xml.EndElement:
+			return nil
+		default:
+			continue
+		}
+
+		switch element.Name.Local {
+		case "LockId":
+			err = d.DecodeElement(&t.LockID, &element)
+		case "Insert":
+			var action Action
+			err = d.DecodeElement(&action, &element)
+			t.Inserts = append(t.Inserts, action)
+		case "Update":
+			var action UpdateAction
+			err = d.DecodeElement(&action, &element)
+			t.Updates = append(t.Updates, action)
+		case "Replace":
+			var action ReplaceAction
+			err = d.DecodeElement(&action, &element)
+			t.Replaces = append(t.Replaces, action)
+		case "Delete":
+			var action DeleteAction
+			err = d.DecodeElement(&action, &element)
+			t.Deletes = append(t.Deletes, action)
+		case "Native":
+			var action NativeAction
+			err = d.DecodeElement(&action, &element)
+			t.Natives = append(t.Natives, action)
+		default:
+			var node Node
+			err = d.DecodeElement(&node, &element)
+			t.Other = append(t.Other, node)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if isAction(element.Name.Local) {
+			t.order = append(t.order, element.Name.Local)
+		}
+	}
+}
+
+// MarshalXML writes the transaction with the namespace declarations and other
+// attributes of the original root element, which the prefixes in the raw
+// feature content and in typeName attributes depend on. Actions are written in
+// their original order.
+func (t Transaction) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Space: Namespace, Local: "Transaction"}
+	if t.XMLName.Space != "" {
+		start.Name = t.XMLName
+	}
+
+	start.Attr = nil
+	if t.Service != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "service"}, Value: t.Service})
+	}
+	if t.Version != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "version"}, Value: t.Version})
+	}
+	start.Attr = append(start.Attr, literalAttrs(t.Attrs)...)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if t.LockID != "" {
+		if err := e.EncodeElement(t.LockID, xml.StartElement{Name: xml.Name{Local: "LockId"}}); err != nil {
+			return err
+		}
+	}
+
+	indices := map[string]int{}
+	for _, name := range t.actionOrder() {
+		i := indices[name]
+		indices[name]++
+
+		var action interface{}
+		switch name {
+		case "Insert":
+			action = t.Inserts[i]
+		case "Update":
+			action = t.Updates[i]
+		case "Replace":
+			action = t.Replaces[i]
+		case "Delete":
+			action = t.Deletes[i]
+		case "Native":
+			action = t.Natives[i]
+		}
+
+		if err := e.EncodeElement(action, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range t.Other {
+		if err := e.Encode(node); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// actionOrder returns the element names of the actions in the order in which
+// they are executed. Actions that were added after decoding follow the decoded
+// actions, and actions that were removed are skipped.
+func (t Transaction) actionOrder() []string {
+	counts := map[string]int{
+		"Insert":  len(t.Inserts),
+		"Update":  len(t.Updates),
+		"Replace": len(t.Replaces),
+		"Delete":  len(t.Deletes),
+		"Native":  len(t.Natives),
+	}
+
+	var order []string
+	seen := map[string]int{}
+	for _, name := range t.order {
+		if seen[name] < counts[name] {
+			order = append(order, name)
+		}
+		seen[name]++
+	}
+
+	for _, name := range []string{"Insert", "Update", "Replace", "Delete", "Native"} {
+		for i := countOf(t.order, name); i < counts[name]; i++ {
+			order = append(order, name)
+		}
+	}
+
+	return order
+}
+
+func isAction(name string) bool {
+	return name == "Insert" || name == "Update" || name == "Replace" || name == "Delete" || name == "Native"
+}
+
+func countOf(names []string, name string) int {
+	count := 0
+	for _, n := range names {
+		if n == name {
+			count++
+		}
+	}
+
+	return count
+}
+
+// IsVersion2 reports whether the transaction uses the WFS 2.0 namespace.
+func (t Transaction) IsVersion2() bool {
+	return t.XMLName.Space == Namespace20
+}
+
+// Validate rejects transactions containing elements that are not understood,
+// filters from a Filter Encoding version that does not match the WFS version,
+// and updates, replaces or deletes without a filter, which would affect every
+// feature of a layer.
+func (t Transaction) Validate() error {
+	if t.XMLName.Space != Namespace && t.XMLName.Space != Namespace20 {
+		return fmt.Errorf("unsupported transaction namespace: %q", t.XMLName.Space)
+	}
+
+	if len(t.Other) > 0 {
+		return fmt.Errorf("unsupported transaction element: %s", t.Other[0].XMLName.Local)
+	}
+
+	if !t.IsVersion2() && (len(t.Replaces) > 0 || len(t.Natives) > 0) {
+		return errors.New("replace and native actions require WFS 2.0")
+	}
+
+	for _, insert := range t.Inserts {
+		for _, layer := range insert.Layers {
+			if _, err := t.TypeName(layer, insert.Attrs); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, update := range t.Updates {
+		if len(update.Other) > 0 {
+			return fmt.Errorf("unsupported update element: %s", update.Other[0].XMLName.Local)
+		}
+
+		if err := t.validateFilter("update", update.Filter); err != nil {
+			return err
+		}
+
+		for _, property := range update.Props {
+			if property.PropertyName() == "" {
+				return errors.New("update property without a name is not allowed")
+			}
+		}
+	}
+
+	for _, replace := range t.Replaces {
+		if len(replace.Layers) != 1 {
+			return errors.New("replace must contain exactly one feature")
+		}
+
+		if _, err := t.TypeName(replace.Layers[0], replace.Attrs); err != nil {
+			return err
+		}
+
+		if err := t.validateFilter("replace", replace.Filter); err != nil {
+			return err
+		}
+	}
+
+	for _, deleteAction := range t.Deletes {
+		if len(deleteAction.Other) > 0 {
+			return fmt.Errorf("unsupported delete element: %s", deleteAction.Other[0].XMLName.Local)
+		}
+
+		if err := t.validateFilter("delete", deleteAction.Filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ActionKey identifies the actions of a transaction on a layer with an
+// operation: insert, update, replace, delete or native. Layers are named as in
+// the typeName attribute of updates and deletes, see TypeName, and native
+// actions by their vendor identifier.
+type ActionKey struct {
+	Layer     string
+	Operation string
+}
+
+// TypeName returns the name of the feature type of an inserted or replaced
+// feature in the form of the typeName attribute of an update or delete: its
+// local name, prefixed with the prefix that is declared for its namespace on
+// the feature, on the action with attributes actionAttrs or on the
+// transaction. A feature in a default namespace for which no prefix is
+// declared has no prefix.
+func (t Transaction) TypeName(layer Layer, actionAttrs []xml.Attr) (string, error) {
+	if layer.XMLName.Space == "" {
+		return layer.XMLName.Local, nil
+	}
+
+	isDefault := false
+	for _, attrs := range [][]xml.Attr{layer.Attrs, actionAttrs, t.Attrs} {
+		for _, attr := range attrs {
+			if attr.Value != layer.XMLName.Space {
+				continue
+			}
+
+			switch {
+			case attr.Name.Space == "xmlns":
+				return attr.Name.Local + ":" + layer.XMLName.Local, nil
+			case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+				isDefault = true
+			}
+		}
+	}
+
+	if isDefault {
+		return layer.XMLName.Local, nil
+	}
+
+	return "", fmt.Errorf("feature %s has no declared namespace prefix", layer.XMLName.Local)
+}
+
+func (t Transaction) validateFilter(action string, filter *Filter) error {
+	if filter == nil {
+		return fmt.Errorf("%s without a filter is not allowed", action)
+	}
+
+	if t.IsVersion2() != (filter.XMLName.Space == fesNamespace) {
+		return fmt.Errorf("%s filter namespace %q does not match the WFS version", action, filter.XMLName.Space)
+	}
+
+	return nil
 }
 
 type Action struct {
-	Layers []Layer `xml:",any"`
+	Attrs  []xml.Attr `xml:",any,attr"`
+	Layers []Layer    `xml:",any"`
+}
+
+func (a Action) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = literalAttrs(a.Attrs)
+	a.Attrs = nil
+
+	type action Action
+	return e.EncodeElement(action(a), start)
 }
 
 type Layer struct {
@@ -23,16 +356,52 @@ type Layer struct {
 	Content []XMLValue `xml:",any"`
 }
 
+func (l Layer) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = l.XMLName
+	start.Attr = literalAttrs(l.Attrs)
+	l.Attrs = nil
+
+	type layer Layer
+	return e.EncodeElement(layer(l), start)
+}
+
 type UpdateAction struct {
 	XMLName  xml.Name   `xml:"Update"`
 	TypeName string     `xml:"typeName,attr"`
+	Attrs    []xml.Attr `xml:",any,attr"`
 	Props    []Property `xml:"Property"`
-	Filter   *Filter    `xml:"http://www.opengis.net/ogc Filter"`
+	Filter   *Filter    `xml:"Filter"`
+	Other    []Node     `xml:",any"`
 }
 
+func (u UpdateAction) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = literalAttrs(u.Attrs)
+	u.Attrs = nil
+
+	type update UpdateAction
+	return e.EncodeElement(update(u), start)
+}
+
+// Property is a property of an update, which is identified by Name in WFS 1.x
+// and by ValueReference in WFS 2.0.
 type Property struct {
-	Name  string    `xml:"Name"`
-	Value *XMLValue `xml:"Value"`
+	Name           string          `xml:"Name,omitempty"`
+	ValueReference *ValueReference `xml:"ValueReference"`
+	Value          *XMLValue       `xml:"Value"`
+}
+
+// PropertyName returns the name of the updated property.
+func (p Property) PropertyName() string {
+	if p.ValueReference != nil {
+		return p.ValueReference.Value
+	}
+
+	return p.Name
+}
+
+type ValueReference struct {
+	Action string `xml:"action,attr,omitempty"`
+	Value  string `xml:",chardata"`
 }
 
 type XMLValue struct {
@@ -41,17 +410,68 @@ type XMLValue struct {
 	Inner   []byte     `xml:",innerxml"`
 }
 
+func (v XMLValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if v.XMLName.Local != "" {
+		start.Name = v.XMLName
+	}
+	start.Attr = literalAttrs(v.Attrs)
+	v.Attrs = nil
+
+	type value XMLValue
+	return e.EncodeElement(value(v), start)
+}
+
+// ReplaceAction replaces the features selected by its filter with the feature
+// it contains (WFS 2.0).
+type ReplaceAction struct {
+	XMLName xml.Name   `xml:"Replace"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Filter  *Filter    `xml:"Filter"`
+	Layers  []Layer    `xml:",any"`
+}
+
+func (r ReplaceAction) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = literalAttrs(r.Attrs)
+
+	// The feature has to precede the filter in a replace action.
+	type replace struct {
+		Layers []Layer `xml:",any"`
+		Filter *Filter `xml:"Filter"`
+	}
+	return e.EncodeElement(replace{Layers: r.Layers, Filter: r.Filter}, start)
+}
+
 type DeleteAction struct {
-	XMLName  xml.Name `xml:"Delete"`
-	TypeName string   `xml:"typeName,attr"`
+	XMLName  xml.Name   `xml:"Delete"`
+	TypeName string     `xml:"typeName,attr"`
+	Attrs    []xml.Attr `xml:",any,attr"`
 
-	Filter *Filter `xml:"http://www.opengis.net/ogc Filter"`
+	Filter *Filter `xml:"Filter"`
+	Other  []Node  `xml:",any"`
 }
 
-type Filter struct {
-	FeatureID FeatureID `xml:"FeatureId"`
+func (d DeleteAction) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = literalAttrs(d.Attrs)
+	d.Attrs = nil
+
+	type deleteAction DeleteAction
+	return e.EncodeElement(deleteAction(d), start)
 }
 
-type FeatureID struct {
-	FID string `xml:"fid,attr"`
+// NativeAction is a vendor specific action of a WFS 2.0 transaction, which is
+// forwarded as is.
+type NativeAction struct {
+	XMLName      xml.Name   `xml:"Native"`
+	VendorID     string     `xml:"vendorId,attr"`
+	SafeToIgnore string     `xml:"safeToIgnore,attr"`
+	Attrs        []xml.Attr `xml:",any,attr"`
+	Inner        []byte     `xml:",innerxml"`
+}
+
+func (n NativeAction) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = literalAttrs(n.Attrs)
+	n.Attrs = nil
+
+	type native NativeAction
+	return e.EncodeElement(native(n), start)
 }
@@ -0,0 +1,100 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestTransactionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{
+			name: "undeclared feature prefix",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs"><wfs:Insert><ws:percelen/></wfs:Insert></wfs:Transaction>`,
+			err:  "no declared namespace prefix",
+		},
+		{
+			name: "update without a filter",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs"><wfs:Update typeName="ws:percelen"/></wfs:Transaction>`,
+			err:  "without a filter",
+		},
+		{
+			name: "filter of another version",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:ogc="http://www.opengis.net/ogc"><wfs:Delete typeName="ws:percelen"><ogc:Filter><ogc:FeatureId fid="percelen.1"/></ogc:Filter></wfs:Delete></wfs:Transaction>`,
+			err:  "does not match the WFS version",
+		},
+		{
+			name: "native in WFS 1.1",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs"><wfs:Native vendorId="x" safeToIgnore="false"/></wfs:Transaction>`,
+			err:  "require WFS 2.0",
+		},
+		{
+			name: "unknown element",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs"><wfs:Lock/></wfs:Transaction>`,
+			err:  "unsupported transaction element",
+		},
+		{
+			name: "valid",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs" xmlns:ws="urn:ws"><wfs:Insert><ws:percelen/></wfs:Insert></wfs:Transaction>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var transaction Transaction
+			if err := xml.Unmarshal([]byte(test.body), &transaction); err != nil {
+				t.Fatal(err)
+			}
+
+			err := transaction.Validate()
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	body := `<wfs:Transaction service="WFS" version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:ws="urn:ws">` +
+		`<wfs:Delete typeName="ws:wegen"><fes:Filter><fes:ResourceId rid="wegen.2"/></fes:Filter></wfs:Delete>` +
+		`<wfs:Insert><ws:percelen gml:id="p.1" xmlns:gml="http://www.opengis.net/gml/3.2"><ws:naam>a</ws:naam></ws:percelen></wfs:Insert>` +
+		`</wfs:Transaction>`
+
+	var transaction Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := xml.Marshal(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Transaction
+	if err := xml.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("%v in %s", err, encoded)
+	}
+
+	if err := decoded.Validate(); err != nil {
+		t.Fatalf("%v in %s", err, encoded)
+	}
+
+	if order := strings.Join(decoded.actionOrder(), ","); order != "Delete,Insert" {
+		t.Errorf("got actions %s, want Delete,Insert", order)
+	}
+
+	if decoded.Deletes[0].TypeName != "ws:wegen" || decoded.Deletes[0].Filter == nil {
+		t.Errorf("delete was not preserved in %s", encoded)
+	}
+
+	if typeName, err := decoded.TypeName(decoded.Inserts[0].Layers[0], decoded.Inserts[0].Attrs); err != nil || typeName != "ws:percelen" {
+		t.Errorf("got type name %q (%v) in %s", typeName, err, encoded)
+	}
+}
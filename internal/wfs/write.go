@@ -0,0 +1,169 @@
+package wfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+// CheckWritableProperties returns an error when an insert, update or replace
+// writes a property that is not allowed by the policy of its layer and
+// operation. As every combination of layer and operation is authorized
+// separately, an action without a policy is an error. Native actions are
+// rejected when any policy restricts a layer, as their content can not be
+// inspected.
+func (t Transaction) CheckWritableProperties(policies map[ActionKey]feature.AttributePolicy) error {
+	for _, insert := range t.Inserts {
+		if err := t.checkFeatureProperties(insert.Layers, insert.Attrs, "insert", policies); err != nil {
+			return err
+		}
+	}
+
+	for _, replace := range t.Replaces {
+		if err := t.checkFeatureProperties(replace.Layers, replace.Attrs, "replace", policies); err != nil {
+			return err
+		}
+	}
+
+	for _, update := range t.Updates {
+		policy, ok := policies[ActionKey{update.TypeName, "update"}]
+		if !ok {
+			return fmt.Errorf("update of %s is not authorized", update.TypeName)
+		}
+
+		for _, property := range update.Props {
+			if !policy.Allows(update.TypeName, property.PropertyName()) {
+				return fmt.Errorf("property %s of %s is read-only", property.PropertyName(), update.TypeName)
+			}
+		}
+	}
+
+	if len(t.Natives) > 0 {
+		for _, policy := range policies {
+			for layer := range policy {
+				if _, restricted := policy.Restricted(layer); restricted {
+					return errors.New("native actions are not allowed when properties are read-only")
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t Transaction) checkFeatureProperties(layers []Layer, actionAttrs []xml.Attr, operation string, policies map[ActionKey]feature.AttributePolicy) error {
+	for _, layer := range layers {
+		typeName, err := t.TypeName(layer, actionAttrs)
+		if err != nil {
+			return err
+		}
+
+		policy, ok := policies[ActionKey{typeName, operation}]
+		if !ok {
+			return fmt.Errorf("%s of %s is not authorized", operation, typeName)
+		}
+
+		for _, property := range layer.Content {
+			if !policy.Allows(typeName, property.XMLName.Local) {
+				return fmt.Errorf("property %s of %s is read-only", property.XMLName.Local, layer.XMLName.Local)
+			}
+		}
+	}
+
+	return nil
+}
+
+// InjectProperties sets server controlled property values, by layer, on all
+// inserted, replaced and updated features, replacing any value the client
+// has sent for these properties.
+func (t *Transaction) InjectProperties(values map[string]map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	for i := range t.Inserts {
+		injectFeatureProperties(t.Inserts[i].Layers, values)
+	}
+
+	for i := range t.Replaces {
+		injectFeatureProperties(t.Replaces[i].Layers, values)
+	}
+
+	for i, update := range t.Updates {
+		for name, value := range layerValues(values, update.TypeName) {
+			property := Property{Value: &XMLValue{Inner: escapeText(value)}}
+			if t.IsVersion2() {
+				property.ValueReference = &ValueReference{Value: name}
+			} else {
+				property.Name = name
+			}
+
+			replaced := false
+			for j, existing := range update.Props {
+				if feature.LocalName(existing.PropertyName()) == name {
+					t.Updates[i].Props[j] = property
+					replaced = true
+				}
+			}
+
+			if !replaced {
+				t.Updates[i].Props = append(t.Updates[i].Props, property)
+			}
+		}
+	}
+}
+
+func injectFeatureProperties(layers []Layer, values map[string]map[string]string) {
+	for i, layer := range layers {
+		for name, value := range layerValues(values, layer.XMLName.Local) {
+			property := XMLValue{
+				XMLName: xml.Name{Space: layer.XMLName.Space, Local: name},
+				Inner:   escapeText(value),
+			}
+
+			replaced := false
+			for j, existing := range layer.Content {
+				if existing.XMLName.Local == name {
+					layers[i].Content[j] = property
+					replaced = true
+				}
+			}
+
+			if !replaced {
+				layers[i].Content = append(layers[i].Content, property)
+			}
+		}
+	}
+}
+
+// layerValues returns the values configured for layer.
+func layerValues(values map[string]map[string]string, layer string) map[string]string {
+	layerValues, _ := layerEntry(values, layer)
+	return layerValues
+}
+
+// layerEntry returns the entry configured for layer, matching on the full name
+// of the layer or on its local name.
+func layerEntry[V any](entries map[string]V, layer string) (V, bool) {
+	if entry, ok := entries[layer]; ok {
+		return entry, true
+	}
+
+	for name, entry := range entries {
+		if feature.LocalName(name) == feature.LocalName(layer) {
+			return entry, true
+		}
+	}
+
+	var zero V
+	return zero, false
+}
+
+func escapeText(value string) []byte {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return escaped.Bytes()
+}
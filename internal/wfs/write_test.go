@@ -0,0 +1,142 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/delta10/filter-proxy/internal/feature"
+)
+
+func TestCheckWritableProperties(t *testing.T) {
+	policy := feature.AttributePolicy{"ws:percelen": {"naam", "geom"}}
+	policies := map[ActionKey]feature.AttributePolicy{
+		{"ws:percelen", "insert"}:  policy,
+		{"ws:percelen", "update"}:  policy,
+		{"ws:percelen", "replace"}: policy,
+		{"ws:wegen", "insert"}:     policy,
+		{"x", "native"}:            policy,
+	}
+
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{
+			name: "allowed insert",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs" xmlns:ws="urn:ws"><wfs:Insert><ws:percelen><ws:naam>a</ws:naam></ws:percelen></wfs:Insert></wfs:Transaction>`,
+		},
+		{
+			name: "read-only insert",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs" xmlns:ws="urn:ws"><wfs:Insert><ws:percelen><ws:eigenaar>b</ws:eigenaar></ws:percelen></wfs:Insert></wfs:Transaction>`,
+			err:  "property eigenaar of percelen is read-only",
+		},
+		{
+			name: "read-only update",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs" xmlns:ogc="http://www.opengis.net/ogc"><wfs:Update typeName="ws:percelen"><wfs:Property><wfs:Name>eigenaar</wfs:Name><wfs:Value>b</wfs:Value></wfs:Property><ogc:Filter><ogc:FeatureId fid="percelen.1"/></ogc:Filter></wfs:Update></wfs:Transaction>`,
+			err:  "property eigenaar of ws:percelen is read-only",
+		},
+		{
+			name: "read-only replace",
+			body: `<wfs:Transaction version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:ws="urn:ws"><wfs:Replace><ws:percelen><ws:eigenaar>b</ws:eigenaar></ws:percelen><fes:Filter><fes:ResourceId rid="percelen.1"/></fes:Filter></wfs:Replace></wfs:Transaction>`,
+			err:  "property eigenaar of percelen is read-only",
+		},
+		{
+			name: "native with a restricted layer",
+			body: `<wfs:Transaction version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0"><wfs:Native vendorId="x" safeToIgnore="false">sql</wfs:Native></wfs:Transaction>`,
+			err:  "native actions are not allowed",
+		},
+		{
+			name: "unrestricted layer",
+			body: `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs" xmlns:ws="urn:ws"><wfs:Insert><ws:wegen><ws:eigenaar>b</ws:eigenaar></ws:wegen></wfs:Insert></wfs:Transaction>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var transaction Transaction
+			if err := xml.Unmarshal([]byte(test.body), &transaction); err != nil {
+				t.Fatal(err)
+			}
+
+			err := transaction.CheckWritableProperties(policies)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCheckWritablePropertiesPerOperation(t *testing.T) {
+	body := `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs" xmlns:ogc="http://www.opengis.net/ogc" xmlns:ws="urn:ws">` +
+		`<wfs:Insert><ws:percelen><ws:naam>a</ws:naam><ws:eigenaar>b</ws:eigenaar></ws:percelen></wfs:Insert>` +
+		`<wfs:Update typeName="ws:percelen"><wfs:Property><wfs:Name>eigenaar</wfs:Name><wfs:Value>c</wfs:Value></wfs:Property><ogc:Filter><ogc:FeatureId fid="percelen.1"/></ogc:Filter></wfs:Update>` +
+		`</wfs:Transaction>`
+
+	var transaction Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := feature.AttributePolicy{"ws:percelen": {"naam", "eigenaar"}}
+	update := feature.AttributePolicy{"ws:percelen": {"naam"}}
+
+	// The insert decision allows more than the update decision, which still
+	// applies to the update, whatever the order of the actions.
+	err := transaction.CheckWritableProperties(map[ActionKey]feature.AttributePolicy{
+		{"ws:percelen", "insert"}: insert,
+		{"ws:percelen", "update"}: update,
+	})
+	if err == nil || !strings.Contains(err.Error(), "property eigenaar of ws:percelen is read-only") {
+		t.Errorf("got error %v, want the update to be rejected", err)
+	}
+
+	err = transaction.CheckWritableProperties(map[ActionKey]feature.AttributePolicy{
+		{"ws:percelen", "insert"}: insert,
+	})
+	if err == nil || !strings.Contains(err.Error(), "update of ws:percelen is not authorized") {
+		t.Errorf("got error %v, want an update without a policy to be rejected", err)
+	}
+}
+
+func TestInjectProperties(t *testing.T) {
+	body := `<wfs:Transaction version="2.0.0" xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:ws="urn:ws">` +
+		`<wfs:Insert><ws:percelen><ws:naam>a</ws:naam><ws:gemeente>0001</ws:gemeente></ws:percelen></wfs:Insert>` +
+		`<wfs:Update typeName="ws:percelen"><wfs:Property><wfs:ValueReference>naam</wfs:ValueReference><wfs:Value>b</wfs:Value></wfs:Property><fes:Filter><fes:ResourceId rid="percelen.1"/></fes:Filter></wfs:Update>` +
+		`</wfs:Transaction>`
+
+	var transaction Transaction
+	if err := xml.Unmarshal([]byte(body), &transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	transaction.InjectProperties(map[string]map[string]string{"percelen": {"gemeente": "0363 & co"}})
+
+	inserted := transaction.Inserts[0].Layers[0].Content
+	if len(inserted) != 2 || inserted[1].XMLName.Local != "gemeente" || string(inserted[1].Inner) != "0363 &amp; co" {
+		t.Errorf("inserted feature has properties %+v", inserted)
+	}
+
+	properties := transaction.Updates[0].Props
+	if len(properties) != 2 || properties[1].PropertyName() != "gemeente" || properties[1].ValueReference == nil {
+		t.Errorf("update has properties %+v", properties)
+	}
+
+	encoded, err := xml.Marshal(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Transaction
+	if err := xml.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("%v in %s", err, encoded)
+	}
+
+	if err := decoded.Validate(); err != nil {
+		t.Errorf("%v in %s", err, encoded)
+	}
+}
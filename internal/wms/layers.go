@@ -0,0 +1,102 @@
+package wms
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/delta10/filter-proxy/internal/utils"
+)
+
+// SplitLayers splits a comma separated LAYERS, QUERY_LAYERS or STYLES value.
+func SplitLayers(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	layers := strings.Split(value, ",")
+	for i, layer := range layers {
+		layers[i] = strings.TrimSpace(layer)
+	}
+
+	return layers
+}
+
+// RequestedLayers returns the unique layer names referenced by the LAYERS,
+// QUERY_LAYERS and LAYER parameters of a (lowercased) WMS query.
+func RequestedLayers(queryParams url.Values) []string {
+	var layers []string
+	seen := map[string]bool{}
+
+	for _, key := range []string{"layers", "query_layers", "layer"} {
+		for _, layer := range SplitLayers(queryParams.Get(key)) {
+			if layer == "" || seen[layer] {
+				continue
+			}
+
+			seen[layer] = true
+			layers = append(layers, layer)
+		}
+	}
+
+	return layers
+}
+
+// RemoveLayers removes the denied layers from the LAYERS, QUERY_LAYERS and
+// LAYER parameters of query, while keeping STYLES aligned with LAYERS. The
+// parameter names of query are matched case-insensitively. It returns false
+// when a parameter that named layers before no longer names any.
+func RemoveLayers(query url.Values, denied map[string]bool) bool {
+	layersKey := utils.QueryParamKey(query, "layers")
+	stylesKey := utils.QueryParamKey(query, "styles")
+
+	if layersKey != "" {
+		layers := SplitLayers(query.Get(layersKey))
+		styles := SplitLayers(query.Get(stylesKey))
+		alignedStyles := len(styles) == len(layers)
+
+		var keptLayers, keptStyles []string
+		for i, layer := range layers {
+			if denied[layer] {
+				continue
+			}
+
+			keptLayers = append(keptLayers, layer)
+			if alignedStyles {
+				keptStyles = append(keptStyles, styles[i])
+			}
+		}
+
+		if len(layers) > 0 && len(keptLayers) == 0 {
+			return false
+		}
+
+		query.Set(layersKey, strings.Join(keptLayers, ","))
+		if stylesKey != "" && alignedStyles {
+			query.Set(stylesKey, strings.Join(keptStyles, ","))
+		}
+	}
+
+	for _, name := range []string{"query_layers", "layer"} {
+		key := utils.QueryParamKey(query, name)
+		if key == "" {
+			continue
+		}
+
+		layers := SplitLayers(query.Get(key))
+
+		var kept []string
+		for _, layer := range layers {
+			if !denied[layer] {
+				kept = append(kept, layer)
+			}
+		}
+
+		if len(layers) > 0 && len(kept) == 0 {
+			return false
+		}
+
+		query.Set(key, strings.Join(kept, ","))
+	}
+
+	return true
+}
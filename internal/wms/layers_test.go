@@ -0,0 +1,73 @@
+package wms
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRequestedLayers(t *testing.T) {
+	query := url.Values{
+		"layers":       {"ws:wegen, ws:percelen"},
+		"query_layers": {"ws:percelen,ws:gebouwen"},
+		"layer":        {"ws:wegen"},
+	}
+
+	want := []string{"ws:wegen", "ws:percelen", "ws:gebouwen"}
+	if layers := RequestedLayers(query); !reflect.DeepEqual(layers, want) {
+		t.Errorf("RequestedLayers() = %v, want %v", layers, want)
+	}
+}
+
+func TestRemoveLayers(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+		want  url.Values
+		kept  bool
+	}{
+		{
+			"aligned styles",
+			url.Values{"LAYERS": {"a,b,c"}, "STYLES": {"sa,sb,sc"}, "QUERY_LAYERS": {"b,c"}},
+			url.Values{"LAYERS": {"a,c"}, "STYLES": {"sa,sc"}, "QUERY_LAYERS": {"c"}},
+			true,
+		},
+		{
+			"default styles",
+			url.Values{"layers": {"a,b"}, "styles": {""}},
+			url.Values{"layers": {"a"}, "styles": {""}},
+			true,
+		},
+		{
+			"no layers left",
+			url.Values{"Layers": {"b"}},
+			nil,
+			false,
+		},
+		{
+			"no query layers left",
+			url.Values{"layers": {"a,b"}, "query_layers": {"b"}},
+			nil,
+			false,
+		},
+		{
+			"legend graphic",
+			url.Values{"layer": {"b"}},
+			nil,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kept := RemoveLayers(test.query, map[string]bool{"b": true})
+			if kept != test.kept {
+				t.Fatalf("RemoveLayers() = %t, want %t", kept, test.kept)
+			}
+
+			if kept && !reflect.DeepEqual(test.query, test.want) {
+				t.Errorf("query = %v, want %v", test.query, test.want)
+			}
+		})
+	}
+}
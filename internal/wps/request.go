@@ -0,0 +1,269 @@
+package wps
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/delta10/filter-proxy/internal/wcs"
+	"github.com/delta10/filter-proxy/internal/wfs"
+	"github.com/delta10/filter-proxy/internal/wms"
+)
+
+// Request is a WPS Execute or DescribeProcess request.
+type Request struct {
+	XMLName xml.Name
+	Service string
+	Version string
+
+	// Identifiers are the processes that are executed or described, including
+	// the processes that are executed as input of another process.
+	Identifiers []string
+
+	// References are the URLs of inputs that are passed by reference, which
+	// the backend fetches itself when executing the process.
+	References []string
+
+	// Layers are the layers and coverages that referenced OWS requests read,
+	// which have to be authorized as well.
+	Layers []string
+}
+
+// ParseRequest parses an XML encoded WPS request. Every process identifier and
+// every reference in the document is collected, also when it is nested in the
+// body of a reference. Referenced requests of which the layers can not be
+// determined, such as stored queries and bodies that are passed by reference,
+// are rejected.
+func ParseRequest(body []byte) (Request, error) {
+	var request Request
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	var stack []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return request, nil
+		}
+		if err != nil {
+			return request, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			parent := ""
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+
+			if len(stack) == 0 {
+				request.XMLName = t.Name
+				request.Service = attr(t, "service")
+				request.Version = attr(t, "version")
+			}
+
+			switch {
+			case t.Name.Local == "Identifier" && (parent == "Execute" || parent == "DescribeProcess"):
+				var identifier string
+				if err := decoder.DecodeElement(&identifier, &t); err != nil {
+					return request, err
+				}
+
+				request.Identifiers = append(request.Identifiers, strings.TrimSpace(identifier))
+				continue
+			case t.Name.Local == "Reference":
+				if href := attr(t, "href"); href != "" {
+					if err := request.addReference(href); err != nil {
+						return request, err
+					}
+				}
+			case t.Name.Local == "BodyReference":
+				return request, errors.New("a reference with a body reference can not be authorized")
+			case parent == "Body":
+				// The body of a reference is a request to another service,
+				// of which only nested Execute requests are parsed further.
+				skip, err := request.addBody(decoder, t)
+				if err != nil {
+					return request, err
+				}
+				if skip {
+					continue
+				}
+			}
+
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// addBody adds the layers read by the request in the body of a reference. It
+// reports whether the body has been consumed.
+func (r *Request) addBody(decoder *xml.Decoder, start xml.StartElement) (bool, error) {
+	switch start.Name.Local {
+	case "Execute":
+		return false, nil
+	case "GetFeature", "GetPropertyValue":
+		var getFeature wfs.GetFeature
+		if err := decoder.DecodeElement(&getFeature, &start); err != nil {
+			return false, err
+		}
+
+		if len(getFeature.StoredQueries) > 0 || len(getFeature.TypeNames()) == 0 {
+			return false, errors.New("a referenced feature request without type names can not be authorized")
+		}
+
+		r.Layers = appendUnique(r.Layers, getFeature.TypeNames()...)
+	case "GetCoverage":
+		var coverageRequest wcs.Request
+		if err := decoder.DecodeElement(&coverageRequest, &start); err != nil {
+			return false, err
+		}
+
+		if len(coverageRequest.Coverages()) == 0 {
+			return false, errors.New("a referenced coverage request without coverages can not be authorized")
+		}
+
+		r.Layers = appendUnique(r.Layers, coverageRequest.Coverages()...)
+	default:
+		return false, fmt.Errorf("a reference with a %s body can not be authorized", start.Name.Local)
+	}
+
+	return true, nil
+}
+
+// addReference adds a referenced URL together with the layers or processes of
+// the OWS request it encodes. URLs without a request parameter are not OWS
+// requests, or are requests of which the body is given separately.
+func (r *Request) addReference(href string) error {
+	r.References = append(r.References, href)
+
+	reference, err := url.Parse(href)
+	if err != nil {
+		return fmt.Errorf("invalid reference %q: %w", href, err)
+	}
+
+	queryParams := url.Values{}
+	for key, values := range reference.Query() {
+		queryParams[strings.ToLower(key)] = values
+	}
+
+	if queryParams.Get("request") == "" {
+		return nil
+	}
+
+	var layers []string
+	switch strings.ToUpper(queryParams.Get("service")) {
+	case "WFS":
+		if queryParams.Get("storedquery_id") != "" {
+			return fmt.Errorf("referenced stored query %q can not be authorized", href)
+		}
+
+		for _, typeName := range strings.FieldsFunc(queryParams.Get("typename")+","+queryParams.Get("typenames"), isTypeNameSeparator) {
+			layers = append(layers, typeName)
+		}
+	case "WCS":
+		layers = wcs.RequestedCoverages(queryParams)
+	case "WMS":
+		layers = wms.RequestedLayers(queryParams)
+	case "WPS":
+		nested, err := ParseQuery(queryParams)
+		if err != nil {
+			return err
+		}
+
+		r.Identifiers = appendUnique(r.Identifiers, nested.Identifiers...)
+		r.References = append(r.References, nested.References...)
+		r.Layers = appendUnique(r.Layers, nested.Layers...)
+		return nil
+	default:
+		return fmt.Errorf("referenced request %q can not be authorized", href)
+	}
+
+	if len(layers) == 0 {
+		return fmt.Errorf("referenced request %q names no layers", href)
+	}
+
+	r.Layers = appendUnique(r.Layers, layers...)
+	return nil
+}
+
+// ParseQuery parses a KVP encoded WPS request from a (lowercased) query. The
+// references in its DATAINPUTS are handled as in an XML request.
+func ParseQuery(queryParams url.Values) (Request, error) {
+	request := Request{
+		Service:     queryParams.Get("service"),
+		Version:     queryParams.Get("version"),
+		Identifiers: RequestedProcesses(queryParams),
+	}
+
+	for _, input := range strings.Split(queryParams.Get("datainputs"), ";") {
+		attributes := strings.Split(input, "@")
+		for _, attribute := range attributes[1:] {
+			key, value, _ := strings.Cut(attribute, "=")
+			if !strings.EqualFold(key, "href") && !strings.EqualFold(key, "xlink:href") {
+				continue
+			}
+
+			href, err := url.QueryUnescape(value)
+			if err != nil {
+				return request, fmt.Errorf("invalid reference %q: %w", value, err)
+			}
+
+			if err := request.addReference(href); err != nil {
+				return request, err
+			}
+		}
+	}
+
+	return request, nil
+}
+
+// RequestedProcesses returns the processes named by the IDENTIFIER parameter
+// of a (lowercased) WPS query.
+func RequestedProcesses(queryParams url.Values) []string {
+	var processes []string
+	for _, identifier := range strings.Split(queryParams.Get("identifier"), ",") {
+		if identifier = strings.TrimSpace(identifier); identifier != "" {
+			processes = append(processes, identifier)
+		}
+	}
+
+	return processes
+}
+
+func isTypeNameSeparator(char rune) bool {
+	return char == ',' || char == '(' || char == ')' || char == ' '
+}
+
+func appendUnique(names []string, added ...string) []string {
+	for _, name := range added {
+		exists := false
+		for _, existing := range names {
+			if existing == name {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func attr(element xml.StartElement, local string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+
+	return ""
+}
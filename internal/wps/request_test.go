@@ -0,0 +1,126 @@
+package wps
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const execute = `<wps:Execute service="WPS" version="1.0.0" xmlns:wps="http://www.opengis.net/wps/1.0.0" xmlns:ows="http://www.opengis.net/ows/1.1" xmlns:xlink="http://www.w3.org/1999/xlink" xmlns:wfs="http://www.opengis.net/wfs" xmlns:wcs="http://www.opengis.net/wcs/1.1.1">
+  <ows:Identifier>vec:Bounds</ows:Identifier>
+  <wps:DataInputs>
+    <wps:Input>
+      <ows:Identifier>features</ows:Identifier>
+      %s
+    </wps:Input>
+  </wps:DataInputs>
+</wps:Execute>`
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		identifiers []string
+		layers      []string
+		err         string
+	}{
+		{
+			name:        "literal input",
+			input:       `<wps:Data><wps:LiteralData>1</wps:LiteralData></wps:Data>`,
+			identifiers: []string{"vec:Bounds"},
+		},
+		{
+			name:        "nested process",
+			input:       `<wps:Reference xlink:href="http://geoserver/wps" method="POST"><wps:Body><wps:Execute version="1.0.0" service="WPS"><ows:Identifier>vec:Query</ows:Identifier><wps:DataInputs><wps:Input><ows:Identifier>features</ows:Identifier><wps:Reference xlink:href="http://geoserver/wfs?service=WFS&amp;request=GetFeature&amp;typeName=brk:percelen"/></wps:Input></wps:DataInputs></wps:Execute></wps:Body></wps:Reference>`,
+			identifiers: []string{"vec:Bounds", "vec:Query"},
+			layers:      []string{"brk:percelen"},
+		},
+		{
+			name:        "feature request body",
+			input:       `<wps:Reference xlink:href="http://geoserver/wfs" method="POST"><wps:Body><wfs:GetFeature service="WFS" version="1.1.0"><wfs:Query typeName="brk:percelen"/></wfs:GetFeature></wps:Body></wps:Reference>`,
+			identifiers: []string{"vec:Bounds"},
+			layers:      []string{"brk:percelen"},
+		},
+		{
+			name:        "coverage request body",
+			input:       `<wps:Reference xlink:href="http://geoserver/wcs" method="POST"><wps:Body><wcs:GetCoverage service="WCS" version="1.1.1"><ows:Identifier>ahn:dtm</ows:Identifier></wcs:GetCoverage></wps:Body></wps:Reference>`,
+			identifiers: []string{"vec:Bounds"},
+			layers:      []string{"ahn:dtm"},
+		},
+		{
+			name:        "external data",
+			input:       `<wps:Reference xlink:href="https://example.com/data.json"/>`,
+			identifiers: []string{"vec:Bounds"},
+		},
+		{
+			name:  "stored query",
+			input: `<wps:Reference xlink:href="http://geoserver/wfs?service=WFS&amp;request=GetFeature&amp;storedquery_id=all"/>`,
+			err:   "stored query",
+		},
+		{
+			name:  "request without layers",
+			input: `<wps:Reference xlink:href="http://geoserver/wfs?service=WFS&amp;request=GetFeature"/>`,
+			err:   "names no layers",
+		},
+		{
+			name:  "unknown service",
+			input: `<wps:Reference xlink:href="http://geoserver/csw?service=CSW&amp;request=GetRecords"/>`,
+			err:   "can not be authorized",
+		},
+		{
+			name:  "body reference",
+			input: `<wps:Reference xlink:href="http://geoserver/wfs" method="POST"><wps:BodyReference xlink:href="https://example.com/query.xml"/></wps:Reference>`,
+			err:   "body reference",
+		},
+		{
+			name:  "unknown body",
+			input: `<wps:Reference xlink:href="http://geoserver/wms" method="POST"><wps:Body><GetMap/></wps:Body></wps:Reference>`,
+			err:   "GetMap body",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := ParseRequest([]byte(strings.Replace(execute, "%s", test.input, 1)))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if request.XMLName.Local != "Execute" || request.Version != "1.0.0" {
+				t.Errorf("got %s %s", request.XMLName.Local, request.Version)
+			}
+
+			if !reflect.DeepEqual(request.Identifiers, test.identifiers) || !reflect.DeepEqual(request.Layers, test.layers) {
+				t.Errorf("got processes %v and layers %v, want %v and %v", request.Identifiers, request.Layers, test.identifiers, test.layers)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	queryParams := url.Values{
+		"identifier": {"vec:Bounds"},
+		"datainputs": {"features=@mimetype=text/xml@xlink:href=" + url.QueryEscape("http://geoserver/wfs?service=WFS&request=GetFeature&typeNames=brk:percelen") + ";mode=fast"},
+	}
+
+	request, err := ParseQuery(queryParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(request.Identifiers, []string{"vec:Bounds"}) || !reflect.DeepEqual(request.Layers, []string{"brk:percelen"}) {
+		t.Errorf("got processes %v and layers %v", request.Identifiers, request.Layers)
+	}
+
+	queryParams.Set("datainputs", "features=@href="+url.QueryEscape("http://geoserver/wfs?service=WFS&request=GetFeature&storedquery_id=all"))
+	if _, err := ParseQuery(queryParams); err == nil {
+		t.Error("expected an error for a referenced stored query")
+	}
+}